@@ -13,7 +13,7 @@ import {
   FriendRequest,
   OwnedPokemon,
   Pokemon,
-  TradeRequest,
+  TradeThread,
   User,
 } from "./models";
 import produce from "immer";
@@ -155,8 +155,8 @@ function App() {
   }>({ sent: [], received: [] });
 
   const [tradeRequests, setTradeRequests] = useState<{
-    sent: TradeRequest[];
-    received: TradeRequest[];
+    sent: TradeThread[];
+    received: TradeThread[];
   }>({ sent: [], received: [] });
 
   const [secondsRemainingUntilNewPokemon, setSecondsRemainingUntilNewPokemon] =
@@ -203,7 +203,11 @@ function App() {
   }, [userSession]);
 
   const onClickPendingPokemon = (index: number) => {
-    selectPokemon(index).then(() => {
+    const pendingPokemon = userSession?.loggedInUser?.pendingPokemon[index];
+    if (!pendingPokemon) {
+      return;
+    }
+    selectPokemon(pendingPokemon.id).then(() => {
       if (!userSession?.loggedInUser || !userSession?.user) {
         return;
       }
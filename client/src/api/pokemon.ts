@@ -1,18 +1,28 @@
 import { z } from "zod";
 import { SERVER_BASE_URL } from "../config";
-import { OwnedPokemon, Pokemon } from "../models";
+import { GENDER_FEMALE, OwnedPokemon, Pokemon } from "../models";
 
 export const spriteUrl = ({
-  pokemon: { forms },
+  pokemon: { forms, hasGenderDifferences },
   formIndex,
   isShiny,
+  gender,
 }: OwnedPokemon) => {
   const defaultForm = forms[0];
   const form = forms[formIndex];
+  const isFemale = hasGenderDifferences && gender === GENDER_FEMALE;
   if (isShiny) {
-    return form.sprites.frontShiny || defaultForm.sprites.frontShiny;
+    return (
+      (isFemale && form.sprites.frontShinyFemale) ||
+      form.sprites.frontShiny ||
+      defaultForm.sprites.frontShiny
+    );
   }
-  return form.sprites.frontDefault || defaultForm.sprites.frontDefault;
+  return (
+    (isFemale && form.sprites.frontFemale) ||
+    form.sprites.frontDefault ||
+    defaultForm.sprites.frontDefault
+  );
 };
 
 export const getPokemons = async (): Promise<Pokemon[]> =>
@@ -20,12 +30,14 @@ export const getPokemons = async (): Promise<Pokemon[]> =>
     .then((res) => res.json())
     .then((json) => z.array(Pokemon).parse(json));
 
-export const selectPokemon = async (index: number): Promise<string> =>
+export const selectPokemon = async (
+  pendingPokemonId: number
+): Promise<string> =>
   fetch(`${SERVER_BASE_URL}/api/v1/pendingPokemon/select`, {
     method: "POST",
     credentials: "include",
     body: JSON.stringify({
-      pendingPokemonIndex: index,
+      pendingPokemonId,
     }),
   })
     .then((res) => res.json())
@@ -1,10 +1,10 @@
 import { z } from "zod";
 import { SERVER_BASE_URL } from "../config";
-import { TradeRequest } from "../models";
+import { TradeThread } from "../models";
 
 export const TradeRequests = z.object({
-  sent: z.array(TradeRequest),
-  received: z.array(TradeRequest),
+  sent: z.array(TradeThread),
+  received: z.array(TradeThread),
 });
 export type TradeRequests = z.infer<typeof TradeRequests>;
 
@@ -16,17 +16,17 @@ export const getTradeRequests = () =>
     .then((json) => TradeRequests.parse(json));
 
 export const postTradeRequest = (
-  pokemonId: number,
+  pokemonIds: number[],
   friendId: number,
-  friendPokemonId: number
+  friendPokemonIds: number[]
 ) =>
   fetch(`${SERVER_BASE_URL}/api/v1/tradeRequests`, {
     method: "POST",
     credentials: "include",
     body: JSON.stringify({
-      pokemonId,
+      pokemonIds,
       friendId,
-      friendPokemonId,
+      friendPokemonIds,
     }),
   }).then((res) => res.json());
 
@@ -38,3 +38,18 @@ export const deleteTradeRequest = (id: number) =>
       tradeRequestId: id,
     }),
   }).then((res) => res.json());
+
+export const counterTradeRequest = (
+  tradeRequestId: number,
+  pokemonIds: number[],
+  friendPokemonIds: number[]
+) =>
+  fetch(`${SERVER_BASE_URL}/api/v1/tradeRequests/counter`, {
+    method: "POST",
+    credentials: "include",
+    body: JSON.stringify({
+      tradeRequestId,
+      pokemonIds,
+      friendPokemonIds,
+    }),
+  }).then((res) => res.json());
@@ -46,7 +46,19 @@ export const acceptTrade = (tradeRequestId: number) =>
     }),
   })
     .then((res) => res.json())
-    .then((json) => z.string().parse(json));
+    .then((json) =>
+      z
+        .object({
+          evolutions: z.array(
+            z.object({
+              ownedPokemonId: z.number(),
+              fromPokemonId: z.number(),
+              toPokemonId: z.number(),
+            })
+          ),
+        })
+        .parse(json)
+    );
 
 export const updatePreferredForm = (pokemonId: number, formIndex: number) =>
   fetch(`${SERVER_BASE_URL}/api/v1/user/preferredForm`, {
@@ -4,7 +4,7 @@ import NotificationIcon from "../assets/bell-solid.svg";
 import FriendListIcon from "../assets/user-group-solid.svg";
 import TradeRequestIcon from "../assets/retweet-solid.svg";
 import PokeballIcon from "../assets/pokeball.svg";
-import { TradeRequest, User, OwnedPokemon } from "../models";
+import { TradeThread, User, OwnedPokemon } from "../models";
 import { useEffect, useRef, useState } from "react";
 import { useElementClientRect } from "../hooks/useElementClientRect";
 import { useOnClickOutsideElements } from "../hooks/useOnClickOutsideElement";
@@ -31,8 +31,8 @@ type NavbarProps = {
   loggedInUser: User | null;
   friendRequests: FriendRequests;
   tradeRequests: {
-    sent: TradeRequest[];
-    received: TradeRequest[];
+    sent: TradeThread[];
+    received: TradeThread[];
   };
   secondsRemainingUntilNewPokemon?: number;
   selectModalButton: React.RefObject<HTMLSpanElement>;
@@ -296,14 +296,13 @@ const Navbar = ({
                       {tradeRequests.sent.length > 0 ? (
                         <ul className="py-1" aria-labelledby="dropdown">
                           {tradeRequests.sent.map(
-                            ({ id, friend, userPokemon, friendPokemon }) => {
-                              const loggedInUserOwnershipStatus =
-                                loggedInUserPokemonOwnershipStatus(
-                                  friendPokemon
-                                );
+                            ({
+                              id: threadId,
+                              latest: { id, friend, userPokemon, friendPokemon },
+                            }) => {
                               return (
                                 <li
-                                  key={id}
+                                  key={threadId}
                                   className="block py-2 px-4 text-sm hover:bg-gray-600 text-gray-200 hover:text-white"
                                 >
                                   <p className="mb-2">
@@ -321,39 +320,53 @@ const Navbar = ({
                                         <span>For your</span>
                                       </div>
                                       <div className="grid grid-cols-2 gap-2">
-                                        <PokemonCard
-                                          key={friendPokemon.id}
-                                          pokemon={friendPokemon}
-                                          className="relative w-full"
-                                          imgClassName={`${
-                                            loggedInUserOwnershipStatus ===
-                                              "owned" && "grayscale"
-                                          }`}
-                                        >
-                                          {loggedInUserOwnershipStatus && (
-                                            <span className="top-[-15px] right-[-5px] absolute text-xs font-bold bg-white rounded-md px-2 py-0.5">
-                                              {loggedInUserOwnershipStatus ===
-                                              "owned" ? (
-                                                <span className="text-gray-600">
-                                                  ALREADY OWNED!
-                                                </span>
-                                              ) : (
-                                                <span className="text-red-500">
-                                                  {
-                                                    notOwnedText[
-                                                      loggedInUserOwnershipStatus
-                                                    ]
-                                                  }
-                                                </span>
-                                              )}
-                                            </span>
-                                          )}
-                                        </PokemonCard>
-                                        <PokemonCard
-                                          key={userPokemon.id}
-                                          pokemon={userPokemon}
-                                          className="relative w-full"
-                                        />
+                                        <div className="flex flex-col gap-2">
+                                          {friendPokemon.map((pokemon) => {
+                                            const loggedInUserOwnershipStatus =
+                                              loggedInUserPokemonOwnershipStatus(
+                                                pokemon
+                                              );
+                                            return (
+                                              <PokemonCard
+                                                key={pokemon.id}
+                                                pokemon={pokemon}
+                                                className="relative w-full"
+                                                imgClassName={`${
+                                                  loggedInUserOwnershipStatus ===
+                                                    "owned" && "grayscale"
+                                                }`}
+                                              >
+                                                {loggedInUserOwnershipStatus && (
+                                                  <span className="top-[-15px] right-[-5px] absolute text-xs font-bold bg-white rounded-md px-2 py-0.5">
+                                                    {loggedInUserOwnershipStatus ===
+                                                    "owned" ? (
+                                                      <span className="text-gray-600">
+                                                        ALREADY OWNED!
+                                                      </span>
+                                                    ) : (
+                                                      <span className="text-red-500">
+                                                        {
+                                                          notOwnedText[
+                                                            loggedInUserOwnershipStatus
+                                                          ]
+                                                        }
+                                                      </span>
+                                                    )}
+                                                  </span>
+                                                )}
+                                              </PokemonCard>
+                                            );
+                                          })}
+                                        </div>
+                                        <div className="flex flex-col gap-2">
+                                          {userPokemon.map((pokemon) => (
+                                            <PokemonCard
+                                              key={pokemon.id}
+                                              pokemon={pokemon}
+                                              className="relative w-full"
+                                            />
+                                          ))}
+                                        </div>
                                       </div>
                                     </div>
                                     <div className="flex flex-col gap-4">
@@ -384,17 +397,12 @@ const Navbar = ({
                         <ul className="py-1" aria-labelledby="dropdown">
                           {tradeRequests.received.map(
                             ({
-                              id,
-                              user,
-                              userPokemon,
-                              friend,
-                              friendPokemon,
+                              id: threadId,
+                              latest: { id, user, userPokemon, friendPokemon },
                             }) => {
-                              const loggedInUserOwnershipStatus =
-                                loggedInUserPokemonOwnershipStatus(userPokemon);
                               return (
                                 <li
-                                  key={id}
+                                  key={threadId}
                                   className="block py-2 px-4 text-sm hover:bg-gray-600 text-gray-200 hover:text-white"
                                 >
                                   <p className="mb-2">
@@ -412,39 +420,53 @@ const Navbar = ({
                                         <span>For your</span>
                                       </div>
                                       <div className="grid grid-cols-2 gap-2">
-                                        <PokemonCard
-                                          key={userPokemon.id}
-                                          pokemon={userPokemon}
-                                          className="relative w-full"
-                                          imgClassName={`${
-                                            loggedInUserOwnershipStatus ===
-                                              "owned" && "grayscale"
-                                          }`}
-                                        >
-                                          {loggedInUserOwnershipStatus && (
-                                            <span className="top-[-15px] right-[-5px] absolute text-xs font-bold bg-white rounded-md px-2 py-0.5">
-                                              {loggedInUserOwnershipStatus ===
-                                              "owned" ? (
-                                                <span className="text-gray-600">
-                                                  ALREADY OWNED!
-                                                </span>
-                                              ) : (
-                                                <span className="text-red-500">
-                                                  {
-                                                    notOwnedText[
-                                                      loggedInUserOwnershipStatus
-                                                    ]
-                                                  }
-                                                </span>
-                                              )}
-                                            </span>
-                                          )}
-                                        </PokemonCard>
-                                        <PokemonCard
-                                          key={friendPokemon.id}
-                                          pokemon={friendPokemon}
-                                          className="relative w-full"
-                                        />
+                                        <div className="flex flex-col gap-2">
+                                          {userPokemon.map((pokemon) => {
+                                            const loggedInUserOwnershipStatus =
+                                              loggedInUserPokemonOwnershipStatus(
+                                                pokemon
+                                              );
+                                            return (
+                                              <PokemonCard
+                                                key={pokemon.id}
+                                                pokemon={pokemon}
+                                                className="relative w-full"
+                                                imgClassName={`${
+                                                  loggedInUserOwnershipStatus ===
+                                                    "owned" && "grayscale"
+                                                }`}
+                                              >
+                                                {loggedInUserOwnershipStatus && (
+                                                  <span className="top-[-15px] right-[-5px] absolute text-xs font-bold bg-white rounded-md px-2 py-0.5">
+                                                    {loggedInUserOwnershipStatus ===
+                                                    "owned" ? (
+                                                      <span className="text-gray-600">
+                                                        ALREADY OWNED!
+                                                      </span>
+                                                    ) : (
+                                                      <span className="text-red-500">
+                                                        {
+                                                          notOwnedText[
+                                                            loggedInUserOwnershipStatus
+                                                          ]
+                                                        }
+                                                      </span>
+                                                    )}
+                                                  </span>
+                                                )}
+                                              </PokemonCard>
+                                            );
+                                          })}
+                                        </div>
+                                        <div className="flex flex-col gap-2">
+                                          {friendPokemon.map((pokemon) => (
+                                            <PokemonCard
+                                              key={pokemon.id}
+                                              pokemon={pokemon}
+                                              className="relative w-full"
+                                            />
+                                          ))}
+                                        </div>
                                       </div>
                                     </div>
                                     <div className="flex flex-col gap-4">
@@ -245,7 +245,11 @@ function UserPage({
     if (!offeredPokemon || !wantedPokemon) {
       return;
     }
-    postTradeRequest(offeredPokemon.id, user.id, wantedPokemon.id).then(() => {
+    postTradeRequest(
+      [offeredPokemon.id],
+      user.id,
+      [wantedPokemon.id]
+    ).then(() => {
       setWantedPokemon(undefined);
       getUserData();
     });
@@ -27,11 +27,16 @@ export const Pokemon = z.object({
 });
 export type Pokemon = z.infer<typeof Pokemon>;
 
+export const GENDER_FEMALE = 1;
+
 export const OwnedPokemon = z.object({
   id: z.number(),
   pokemon: Pokemon,
   formIndex: z.number(),
   isShiny: z.boolean(),
+  gender: z.number().optional(),
+  nickname: z.string().optional(),
+  isFavorite: z.boolean().optional(),
 });
 export type OwnedPokemon = z.infer<typeof OwnedPokemon>;
 
@@ -58,9 +63,21 @@ export type FriendRequest = z.infer<typeof FriendRequest>;
 
 export const TradeRequest = z.object({
   id: z.number(),
+  threadId: z.number(),
+  status: z.string(),
   user: PartialUser,
-  userPokemon: OwnedPokemon,
+  userPokemon: z.array(OwnedPokemon),
   friend: PartialUser,
-  friendPokemon: OwnedPokemon,
+  friendPokemon: z.array(OwnedPokemon),
+  expiresAt: z.number(), // millis since epoch
 });
 export type TradeRequest = z.infer<typeof TradeRequest>;
+
+// A negotiation between two users, where each counter-offer supersedes the
+// previous proposal
+export const TradeThread = z.object({
+  id: z.number(),
+  latest: TradeRequest,
+  proposals: z.array(TradeRequest),
+});
+export type TradeThread = z.infer<typeof TradeThread>;
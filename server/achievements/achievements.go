@@ -0,0 +1,197 @@
+package achievements
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"susie.mx/gokemon/models"
+)
+
+type Event string
+
+const (
+	PokemonCaught  Event = "pokemonCaught"
+	TradeCompleted Event = "tradeCompleted"
+	FriendAdded    Event = "friendAdded"
+	PokemonEvolved Event = "pokemonEvolved"
+)
+
+type Rule struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Events      []Event `json:"-"`
+	// Earned reports whether the user currently meets the rule
+	Earned func(db *gorm.DB, userID uint) (bool, error) `json:"-"`
+}
+
+var Rules = []Rule{
+	{
+		ID:          "first-shiny",
+		Name:        "Shiny Hunter",
+		Description: "Catch your first shiny Pokemon",
+		Events:      []Event{PokemonCaught},
+		Earned:      caughtShiny,
+	},
+	{
+		ID:          "caught-100",
+		Name:        "Pokemon Collector",
+		Description: "Catch 100 Pokemon",
+		Events:      []Event{PokemonCaught},
+		Earned:      caughtAtLeast(100),
+	},
+	{
+		ID:          "complete-type",
+		Name:        "Type Specialist",
+		Description: "Catch every Pokemon of a single type",
+		Events:      []Event{PokemonCaught, TradeCompleted, PokemonEvolved},
+		Earned:      completedAnyType,
+	},
+	{
+		ID:          "first-trade",
+		Name:        "Trader",
+		Description: "Complete your first trade",
+		Events:      []Event{TradeCompleted},
+		Earned:      tradedAtLeast(1),
+	},
+	{
+		ID:          "all-legendaries",
+		Name:        "Living Legend",
+		Description: "Catch every legendary Pokemon",
+		Events:      []Event{PokemonCaught, TradeCompleted, PokemonEvolved},
+		Earned:      caughtAllLegendaries,
+	},
+	{
+		ID:          "friends-10",
+		Name:        "Social Butterfly",
+		Description: "Make 10 friends",
+		Events:      []Event{FriendAdded},
+		Earned:      friendsAtLeast(10),
+	},
+}
+
+func Find(id string) (Rule, bool) {
+	for _, rule := range Rules {
+		if rule.ID == id {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Evaluate checks every rule that listens for the event and awards the ones the
+// user has newly earned, returning them.
+func Evaluate(db *gorm.DB, userID uint, event Event) ([]Rule, error) {
+	var awarded []string
+	if err := db.Model(&models.UserAchievement{}).Where("user_id = ?", userID).Pluck("achievement_id", &awarded).Error; err != nil {
+		return nil, err
+	}
+	alreadyAwarded := map[string]bool{}
+	for _, id := range awarded {
+		alreadyAwarded[id] = true
+	}
+	var earned []Rule
+	for _, rule := range Rules {
+		if alreadyAwarded[rule.ID] || !listensFor(rule, event) {
+			continue
+		}
+		ok, err := rule.Earned(db, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.UserAchievement{
+			UserID:        userID,
+			AchievementID: rule.ID,
+			AwardedAt:     time.Now().UnixMilli(),
+		})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		// Someone else may have awarded it in the meantime
+		if result.RowsAffected > 0 {
+			earned = append(earned, rule)
+		}
+	}
+	return earned, nil
+}
+
+func listensFor(rule Rule, event Event) bool {
+	for _, e := range rule.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// caughtShiny only counts shinies the user caught themselves, not ones they
+// were traded
+func caughtShiny(db *gorm.DB, userID uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.OwnershipRecord{}).
+		Joins("JOIN owned_pokemons ON owned_pokemons.id = ownership_records.owned_pokemon_id").
+		Where("ownership_records.owner_id = ? AND ownership_records.method = ? AND owned_pokemons.is_shiny", userID, models.AcquiredByCatching).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func caughtAtLeast(n int64) func(db *gorm.DB, userID uint) (bool, error) {
+	return func(db *gorm.DB, userID uint) (bool, error) {
+		var count int64
+		err := db.Model(&models.OwnershipRecord{}).
+			Where("owner_id = ? AND method = ?", userID, models.AcquiredByCatching).
+			Count(&count).Error
+		return count >= n, err
+	}
+}
+
+// completedAnyType counts, for each type, the species with a form of that type
+// and how many of them the user has caught, like the pokedex does
+func completedAnyType(db *gorm.DB, userID uint) (bool, error) {
+	var completed []string
+	err := db.Table("pokemon_types").
+		Select("pokemon_types.type_name").
+		Joins("JOIN pokemon_forms ON pokemon_forms.id = pokemon_types.pokemon_form_id").
+		Group("pokemon_types.type_name").
+		Having(`COUNT(DISTINCT pokemon_forms.pokemon_id) = COUNT(DISTINCT CASE WHEN EXISTS (
+			SELECT 1 FROM pokedex_entries WHERE pokedex_entries.pokemon_id = pokemon_forms.pokemon_id AND user_id = ? AND is_caught
+		) THEN pokemon_forms.pokemon_id END)`, userID).
+		Limit(1).
+		Pluck("pokemon_types.type_name", &completed).Error
+	return len(completed) > 0, err
+}
+
+func tradedAtLeast(n int64) func(db *gorm.DB, userID uint) (bool, error) {
+	return func(db *gorm.DB, userID uint) (bool, error) {
+		var count int64
+		err := db.Model(&models.Trade{}).
+			Where("user_id = ? OR friend_id = ?", userID, userID).
+			Count(&count).Error
+		return count >= n, err
+	}
+}
+
+func caughtAllLegendaries(db *gorm.DB, userID uint) (bool, error) {
+	var numLegendaries, numCaught int64
+	err := db.Model(&models.Pokemon{}).Where("is_legendary").Count(&numLegendaries).Error
+	if err != nil {
+		return false, err
+	}
+	err = db.Model(&models.Pokemon{}).
+		Where("is_legendary").
+		Where("EXISTS (SELECT 1 FROM pokedex_entries WHERE pokedex_entries.pokemon_id = pokemons.id AND user_id = ? AND is_caught)", userID).
+		Count(&numCaught).Error
+	return numLegendaries > 0 && numCaught == numLegendaries, err
+}
+
+func friendsAtLeast(n int64) func(db *gorm.DB, userID uint) (bool, error) {
+	return func(db *gorm.DB, userID uint) (bool, error) {
+		var count int64
+		err := db.Table("user_friends").Where("user_id = ?", userID).Count(&count).Error
+		return count >= n, err
+	}
+}
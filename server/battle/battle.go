@@ -0,0 +1,518 @@
+package battle
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"susie.mx/gokemon/models"
+)
+
+const MaxTeamSize = 6
+
+// MaxTurns ends battles that nobody can win, e.g. between two ghosts that
+// only know normal moves, in a draw
+const MaxTurns = 200
+
+type Condition string
+
+const (
+	Burn      Condition = "burn"
+	Freeze    Condition = "freeze"
+	Paralysis Condition = "paralysis"
+	Poison    Condition = "poison"
+	Sleep     Condition = "sleep"
+)
+
+var (
+	ErrTeamSize      = errors.New("teams must have between 1 and 6 pokemon")
+	ErrMissingForm   = errors.New("pokemon must be loaded with its forms and their types")
+	ErrBattleOver    = errors.New("battle is over")
+	ErrInvalidAction = errors.New("invalid action")
+)
+
+type Combatant struct {
+	OwnedPokemonID uint         `json:"ownedPokemonId"`
+	Name           string       `json:"name"`
+	Level          uint         `json:"level"`
+	Types          []string     `json:"types"`
+	Stats          models.Stats `json:"stats"`
+	HP             uint         `json:"hp"`
+	Condition      Condition    `json:"condition,omitempty"`
+	SleepTurns     uint         `json:"-"`
+	Moves          []Move       `json:"moves"`
+}
+
+// NewCombatant prepares an owned pokemon for battle. Its Pokemon must be
+// loaded with its forms and their types.
+func NewCombatant(p models.OwnedPokemon) (*Combatant, error) {
+	if int(p.FormIndex) >= len(p.Pokemon.Forms) {
+		return nil, ErrMissingForm
+	}
+	form := p.Pokemon.Forms[p.FormIndex]
+	var types []string
+	for _, t := range form.Types {
+		types = append(types, t.Name)
+	}
+	name := p.Nickname
+	if name == "" {
+		name = form.Name
+	}
+	level := p.Level
+	if level == 0 {
+		level = 1
+	}
+	stats := CalcStats(form.BaseStats, p.IVs, level, p.Nature)
+	return &Combatant{
+		OwnedPokemonID: p.ID,
+		Name:           name,
+		Level:          level,
+		Types:          types,
+		Stats:          stats,
+		HP:             stats.HP,
+		Moves:          MoveSet(types, stats),
+	}, nil
+}
+
+func (c *Combatant) Fainted() bool {
+	return c.HP == 0
+}
+
+func (c *Combatant) damage(amount uint) uint {
+	if amount > c.HP {
+		amount = c.HP
+	}
+	c.HP -= amount
+	return amount
+}
+
+func (c *Combatant) speed() uint {
+	if c.Condition == Paralysis {
+		return c.Stats.Speed / 2
+	}
+	return c.Stats.Speed
+}
+
+type Side struct {
+	Team   []*Combatant `json:"team"`
+	Active int          `json:"active"`
+}
+
+func (s *Side) active() *Combatant {
+	return s.Team[s.Active]
+}
+
+func (s *Side) defeated() bool {
+	for _, c := range s.Team {
+		if !c.Fainted() {
+			return false
+		}
+	}
+	return true
+}
+
+type ActionKind string
+
+const (
+	ActionMove   ActionKind = "move"
+	ActionSwitch ActionKind = "switch"
+)
+
+// An Action is what a side does in a turn: use the move at Index of its
+// active pokemon, or switch to the team member at Index
+type Action struct {
+	Kind  ActionKind `json:"kind"`
+	Index int        `json:"index"`
+}
+
+type EntryKind string
+
+const (
+	EntrySwitch    EntryKind = "switch"
+	EntryMove      EntryKind = "move"
+	EntryMiss      EntryKind = "miss"
+	EntryDamage    EntryKind = "damage"
+	EntryCondition EntryKind = "condition"
+	EntryCantMove  EntryKind = "cantMove"
+	EntryRecover   EntryKind = "recover"
+	EntryFaint     EntryKind = "faint"
+	EntryEnd       EntryKind = "end"
+)
+
+// An Entry in the battle log describes one thing that happened. Side is the
+// side of the pokemon it happened to.
+type Entry struct {
+	Turn          int       `json:"turn"`
+	Side          int       `json:"side"`
+	Kind          EntryKind `json:"kind"`
+	Pokemon       string    `json:"pokemon,omitempty"`
+	Move          string    `json:"move,omitempty"`
+	Damage        uint      `json:"damage,omitempty"`
+	Effectiveness float64   `json:"effectiveness,omitempty"`
+	Critical      bool      `json:"critical,omitempty"`
+	Condition     Condition `json:"condition,omitempty"`
+	Message       string    `json:"message"`
+}
+
+// A Battle between two sides. Everything random is drawn from a generator
+// seeded with the battle's seed, so playing the same actions on a battle with
+// the same seed and teams always gives the same result.
+type Battle struct {
+	// Kept from players, who could otherwise predict every roll
+	Seed  int64   `json:"-"`
+	Sides [2]Side `json:"sides"`
+	Turn  int     `json:"turn"`
+	Log   []Entry `json:"log"`
+	// -1 while the battle is ongoing or if it ended in a draw
+	Winner int  `json:"winner"`
+	Over   bool `json:"over"`
+
+	rng *rand.Rand
+}
+
+func New(seed int64, teams [2][]models.OwnedPokemon) (*Battle, error) {
+	b := &Battle{
+		Seed:   seed,
+		Winner: -1,
+		rng:    rand.New(rand.NewSource(seed)),
+	}
+	for i, team := range teams {
+		if len(team) == 0 || len(team) > MaxTeamSize {
+			return nil, ErrTeamSize
+		}
+		for _, p := range team {
+			c, err := NewCombatant(p)
+			if err != nil {
+				return nil, err
+			}
+			b.Sides[i].Team = append(b.Sides[i].Team, c)
+		}
+		b.log(Entry{Side: i, Kind: EntrySwitch, Pokemon: b.Sides[i].active().Name},
+			"%s is sent out", b.Sides[i].active().Name)
+	}
+	return b, nil
+}
+
+// Replay plays a battle from the start with the actions of each turn
+func Replay(seed int64, teams [2][]models.OwnedPokemon, turns [][2]Action) (*Battle, error) {
+	b, err := New(seed, teams)
+	if err != nil {
+		return nil, err
+	}
+	for i, actions := range turns {
+		if err := b.Play(actions); err != nil {
+			return nil, fmt.Errorf("playing turn %d failed: %w", i+1, err)
+		}
+	}
+	return b, nil
+}
+
+// Validate checks that a side can take the action this turn
+func (b *Battle) Validate(side int, action Action) error {
+	if b.Over {
+		return ErrBattleOver
+	}
+	s := &b.Sides[side]
+	switch action.Kind {
+	case ActionMove:
+		if action.Index < 0 || action.Index >= len(s.active().Moves) {
+			return ErrInvalidAction
+		}
+	case ActionSwitch:
+		if action.Index < 0 || action.Index >= len(s.Team) ||
+			action.Index == s.Active || s.Team[action.Index].Fainted() {
+			return ErrInvalidAction
+		}
+	default:
+		return ErrInvalidAction
+	}
+	return nil
+}
+
+// Play resolves a turn in which both sides take an action. Switching happens
+// first, then moves in order of priority and speed.
+func (b *Battle) Play(actions [2]Action) error {
+	for side, action := range actions {
+		if err := b.Validate(side, action); err != nil {
+			return err
+		}
+	}
+	b.Turn++
+	for _, side := range b.order(actions) {
+		action := actions[side]
+		if action.Kind == ActionSwitch {
+			b.switchTo(side, action.Index)
+			continue
+		}
+		attacker := b.Sides[side].active()
+		// A pokemon that fainted earlier in the turn does not get to move
+		if attacker.Fainted() {
+			continue
+		}
+		b.useMove(side, attacker.Moves[action.Index])
+		if b.checkOver() {
+			return nil
+		}
+	}
+	for side := range b.Sides {
+		b.endOfTurn(side)
+	}
+	if b.checkOver() {
+		return nil
+	}
+	for side := range b.Sides {
+		b.replaceFainted(side)
+	}
+	if b.Turn >= MaxTurns {
+		b.Over = true
+		b.log(Entry{Side: -1, Kind: EntryEnd}, "the battle ends in a draw")
+	}
+	return nil
+}
+
+func (b *Battle) order(actions [2]Action) []int {
+	first, second := 0, 1
+	priority := func(side int) int {
+		action := actions[side]
+		if action.Kind == ActionSwitch {
+			// Switching always goes before any move
+			return 100
+		}
+		return b.Sides[side].active().Moves[action.Index].Priority
+	}
+	switch p0, p1 := priority(0), priority(1); {
+	case p0 != p1:
+		if p1 > p0 {
+			first, second = 1, 0
+		}
+	default:
+		s0, s1 := b.Sides[0].active().speed(), b.Sides[1].active().speed()
+		if s1 > s0 || (s1 == s0 && b.rng.Intn(2) == 1) {
+			first, second = 1, 0
+		}
+	}
+	return []int{first, second}
+}
+
+func (b *Battle) switchTo(side int, index int) {
+	s := &b.Sides[side]
+	previous := s.active()
+	s.Active = index
+	b.log(Entry{Side: side, Kind: EntrySwitch, Pokemon: s.active().Name},
+		"%s is withdrawn, %s is sent out", previous.Name, s.active().Name)
+}
+
+// replaceFainted sends out the next pokemon in the team that can still fight
+func (b *Battle) replaceFainted(side int) {
+	s := &b.Sides[side]
+	if !s.active().Fainted() {
+		return
+	}
+	for i, c := range s.Team {
+		if !c.Fainted() {
+			s.Active = i
+			b.log(Entry{Side: side, Kind: EntrySwitch, Pokemon: c.Name}, "%s is sent out", c.Name)
+			return
+		}
+	}
+}
+
+// canMove checks whether a condition stops the pokemon from moving this turn,
+// which may also cure it
+func (b *Battle) canMove(side int, c *Combatant) bool {
+	switch c.Condition {
+	case Sleep:
+		if c.SleepTurns > 0 {
+			c.SleepTurns--
+			b.log(Entry{Side: side, Kind: EntryCantMove, Pokemon: c.Name, Condition: Sleep}, "%s is fast asleep", c.Name)
+			return false
+		}
+		c.Condition = ""
+		b.log(Entry{Side: side, Kind: EntryRecover, Pokemon: c.Name, Condition: Sleep}, "%s woke up", c.Name)
+	case Freeze:
+		if b.rng.Intn(5) != 0 {
+			b.log(Entry{Side: side, Kind: EntryCantMove, Pokemon: c.Name, Condition: Freeze}, "%s is frozen solid", c.Name)
+			return false
+		}
+		c.Condition = ""
+		b.log(Entry{Side: side, Kind: EntryRecover, Pokemon: c.Name, Condition: Freeze}, "%s thawed out", c.Name)
+	case Paralysis:
+		if b.rng.Intn(4) == 0 {
+			b.log(Entry{Side: side, Kind: EntryCantMove, Pokemon: c.Name, Condition: Paralysis}, "%s is paralyzed and can't move", c.Name)
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Battle) useMove(side int, move Move) {
+	attacker := b.Sides[side].active()
+	defender := b.Sides[1-side].active()
+	if !b.canMove(side, attacker) {
+		return
+	}
+	b.log(Entry{Side: side, Kind: EntryMove, Pokemon: attacker.Name, Move: move.Name},
+		"%s used %s", attacker.Name, move.Name)
+	if uint(b.rng.Intn(100)) >= move.Accuracy {
+		b.log(Entry{Side: side, Kind: EntryMiss, Pokemon: attacker.Name, Move: move.Name}, "%s missed", attacker.Name)
+		return
+	}
+	effectiveness := Effectiveness(move.Type, defender.Types)
+	if effectiveness == 0 {
+		b.log(Entry{Side: 1 - side, Kind: EntryDamage, Pokemon: defender.Name, Move: move.Name},
+			"it doesn't affect %s", defender.Name)
+		return
+	}
+	if move.Category == Status {
+		b.inflict(1-side, defender, move.Causes, true)
+		return
+	}
+	damage, critical := b.calcDamage(attacker, defender, move, effectiveness)
+	damage = defender.damage(damage)
+	b.log(Entry{
+		Side:          1 - side,
+		Kind:          EntryDamage,
+		Pokemon:       defender.Name,
+		Move:          move.Name,
+		Damage:        damage,
+		Effectiveness: effectiveness,
+		Critical:      critical,
+	}, "%s took %d damage%s", defender.Name, damage, damageRemark(effectiveness, critical))
+	if b.faint(1-side, defender) {
+		return
+	}
+	if move.Causes != "" && uint(b.rng.Intn(100)) < move.StatusChance {
+		b.inflict(1-side, defender, move.Causes, false)
+	}
+}
+
+// calcDamage uses the damage formula of the games, without abilities, items
+// or weather
+func (b *Battle) calcDamage(attacker *Combatant, defender *Combatant, move Move, effectiveness float64) (uint, bool) {
+	attack, defense := attacker.Stats.Attack, defender.Stats.Defense
+	if move.Category == Special {
+		attack, defense = attacker.Stats.SpecialAttack, defender.Stats.SpecialDefense
+	}
+	if defense == 0 {
+		defense = 1
+	}
+	damage := float64((2*attacker.Level/5+2)*move.Power*attack/defense)/50 + 2
+	critical := b.rng.Intn(24) == 0
+	if critical {
+		damage *= 1.5
+	}
+	damage *= float64(85+b.rng.Intn(16)) / 100
+	if hasType(attacker.Types, move.Type) {
+		damage *= 1.5
+	}
+	damage *= effectiveness
+	if attacker.Condition == Burn && move.Category == Physical {
+		damage /= 2
+	}
+	if damage < 1 {
+		damage = 1
+	}
+	return uint(damage), critical
+}
+
+func damageRemark(effectiveness float64, critical bool) string {
+	remark := ""
+	if critical {
+		remark += ", a critical hit"
+	}
+	switch {
+	case effectiveness > 1:
+		remark += ", it's super effective"
+	case effectiveness < 1:
+		remark += ", it's not very effective"
+	}
+	return remark
+}
+
+// immune reports whether a pokemon's types protect it from a condition
+func immune(c *Combatant, condition Condition) bool {
+	switch condition {
+	case Burn:
+		return hasType(c.Types, "fire")
+	case Freeze:
+		return hasType(c.Types, "ice")
+	case Paralysis:
+		return hasType(c.Types, "electric")
+	case Poison:
+		return hasType(c.Types, "poison") || hasType(c.Types, "steel")
+	}
+	return false
+}
+
+// inflict gives the pokemon a condition, if it has none yet. Only status
+// moves tell when they fail.
+func (b *Battle) inflict(side int, c *Combatant, condition Condition, announceFailure bool) {
+	if c.Condition != "" || immune(c, condition) {
+		if announceFailure {
+			b.log(Entry{Side: side, Kind: EntryCondition, Pokemon: c.Name}, "it failed")
+		}
+		return
+	}
+	c.Condition = condition
+	if condition == Sleep {
+		c.SleepTurns = uint(1 + b.rng.Intn(3))
+	}
+	b.log(Entry{Side: side, Kind: EntryCondition, Pokemon: c.Name, Condition: condition},
+		"%s is affected by %s", c.Name, condition)
+}
+
+// endOfTurn hurts the active pokemon if it is burned or poisoned
+func (b *Battle) endOfTurn(side int) {
+	c := b.Sides[side].active()
+	if c.Fainted() {
+		return
+	}
+	var fraction uint
+	switch c.Condition {
+	case Burn:
+		fraction = 16
+	case Poison:
+		fraction = 8
+	default:
+		return
+	}
+	damage := c.Stats.HP / fraction
+	if damage == 0 {
+		damage = 1
+	}
+	damage = c.damage(damage)
+	b.log(Entry{Side: side, Kind: EntryDamage, Pokemon: c.Name, Damage: damage, Condition: c.Condition},
+		"%s is hurt by its %s", c.Name, c.Condition)
+	b.faint(side, c)
+}
+
+func (b *Battle) faint(side int, c *Combatant) bool {
+	if !c.Fainted() {
+		return false
+	}
+	b.log(Entry{Side: side, Kind: EntryFaint, Pokemon: c.Name}, "%s fainted", c.Name)
+	return true
+}
+
+func (b *Battle) checkOver() bool {
+	defeated := [2]bool{b.Sides[0].defeated(), b.Sides[1].defeated()}
+	switch {
+	case defeated[0] && defeated[1]:
+		b.Over = true
+		b.log(Entry{Side: -1, Kind: EntryEnd}, "the battle ends in a draw")
+	case defeated[0] || defeated[1]:
+		b.Over = true
+		b.Winner = 0
+		if defeated[0] {
+			b.Winner = 1
+		}
+		b.log(Entry{Side: b.Winner, Kind: EntryEnd}, "side %d wins", b.Winner+1)
+	}
+	return b.Over
+}
+
+func (b *Battle) log(entry Entry, format string, args ...interface{}) {
+	entry.Turn = b.Turn
+	entry.Message = fmt.Sprintf(format, args...)
+	b.Log = append(b.Log, entry)
+}
@@ -0,0 +1,193 @@
+package battle_test
+
+import (
+	"reflect"
+	"testing"
+
+	"susie.mx/gokemon/battle"
+	"susie.mx/gokemon/models"
+)
+
+func testPokemon(id uint, name string, level uint, base models.Stats, types ...string) models.OwnedPokemon {
+	form := models.PokemonForm{Name: name, BaseStats: base}
+	for _, t := range types {
+		form.Types = append(form.Types, models.Type{Name: t})
+	}
+	return models.OwnedPokemon{
+		ID:      id,
+		Level:   level,
+		Nature:  "hardy",
+		Pokemon: models.Pokemon{Forms: []models.PokemonForm{form}},
+	}
+}
+
+var (
+	charizard = models.Stats{HP: 78, Attack: 84, Defense: 78, SpecialAttack: 109, SpecialDefense: 85, Speed: 100}
+	blastoise = models.Stats{HP: 79, Attack: 83, Defense: 100, SpecialAttack: 85, SpecialDefense: 105, Speed: 78}
+	venusaur  = models.Stats{HP: 80, Attack: 82, Defense: 83, SpecialAttack: 100, SpecialDefense: 100, Speed: 80}
+)
+
+func testTeams() [2][]models.OwnedPokemon {
+	return [2][]models.OwnedPokemon{
+		{
+			testPokemon(1, "Charizard", 50, charizard, "fire", "flying"),
+			testPokemon(2, "Venusaur", 50, venusaur, "grass", "poison"),
+		},
+		{
+			testPokemon(3, "Blastoise", 50, blastoise, "water"),
+			testPokemon(4, "Venusaur", 50, venusaur, "grass", "poison"),
+		},
+	}
+}
+
+// playOut uses each side's first move until the battle is over
+func playOut(t *testing.T, b *battle.Battle) [][2]battle.Action {
+	t.Helper()
+	var turns [][2]battle.Action
+	for !b.Over {
+		actions := [2]battle.Action{{Kind: battle.ActionMove}, {Kind: battle.ActionMove}}
+		if err := b.Play(actions); err != nil {
+			t.Fatalf("playing turn %d failed: %s", b.Turn+1, err)
+		}
+		turns = append(turns, actions)
+	}
+	return turns
+}
+
+func TestEffectiveness(t *testing.T) {
+	cases := []struct {
+		moveType string
+		types    []string
+		expected float64
+	}{
+		{"water", []string{"fire"}, 2},
+		{"electric", []string{"water", "flying"}, 4},
+		{"grass", []string{"fire", "flying"}, 0.25},
+		{"ground", []string{"flying"}, 0},
+		{"normal", []string{"psychic"}, 1},
+	}
+	for _, c := range cases {
+		if got := battle.Effectiveness(c.moveType, c.types); got != c.expected {
+			t.Fatalf("%s against %v: expected %v, got %v", c.moveType, c.types, c.expected, got)
+		}
+	}
+}
+
+func TestCalcStats(t *testing.T) {
+	garchomp := models.Stats{HP: 108, Attack: 130, Defense: 95, SpecialAttack: 80, SpecialDefense: 85, Speed: 102}
+	ivs := models.Stats{HP: 31, Attack: 31, Defense: 31, SpecialAttack: 31, SpecialDefense: 31, Speed: 31}
+	stats := battle.CalcStats(garchomp, ivs, 100, "adamant")
+	expected := models.Stats{HP: 357, Attack: 325, Defense: 226, SpecialAttack: 176, SpecialDefense: 206, Speed: 240}
+	if stats != expected {
+		t.Fatalf("expected %+v, got %+v", expected, stats)
+	}
+}
+
+func TestBattleIsDeterministic(t *testing.T) {
+	first, err := battle.New(42, testTeams())
+	if err != nil {
+		t.Fatalf("failed to create battle: %s", err)
+	}
+	turns := playOut(t, first)
+	replay, err := battle.Replay(42, testTeams(), turns)
+	if err != nil {
+		t.Fatalf("failed to replay battle: %s", err)
+	}
+	if !reflect.DeepEqual(first.Log, replay.Log) || first.Winner != replay.Winner {
+		t.Fatalf("replaying the same seed and actions gave a different battle")
+	}
+	if first.Winner == -1 {
+		t.Fatalf("expected the battle to have a winner")
+	}
+}
+
+func TestSuperEffectiveMoveWins(t *testing.T) {
+	teams := [2][]models.OwnedPokemon{
+		{testPokemon(1, "Blastoise", 50, blastoise, "water")},
+		{testPokemon(2, "Charizard", 50, charizard, "fire", "flying")},
+	}
+	wins := 0
+	for seed := int64(0); seed < 20; seed++ {
+		b, err := battle.New(seed, teams)
+		if err != nil {
+			t.Fatalf("failed to create battle: %s", err)
+		}
+		playOut(t, b)
+		if b.Winner == 0 {
+			wins++
+		}
+	}
+	if wins < 15 {
+		t.Fatalf("expected surf to beat flamethrower most of the time, won %d of 20", wins)
+	}
+}
+
+func TestFaintedPokemonIsReplaced(t *testing.T) {
+	b, err := battle.New(1, testTeams())
+	if err != nil {
+		t.Fatalf("failed to create battle: %s", err)
+	}
+	playOut(t, b)
+	loser := b.Sides[1-b.Winner]
+	for _, c := range loser.Team {
+		if !c.Fainted() {
+			t.Fatalf("%s has not fainted but its side lost", c.Name)
+		}
+	}
+}
+
+func TestInvalidActions(t *testing.T) {
+	b, err := battle.New(1, testTeams())
+	if err != nil {
+		t.Fatalf("failed to create battle: %s", err)
+	}
+	invalid := []battle.Action{
+		{Kind: battle.ActionMove, Index: battle.MaxMoves},
+		{Kind: battle.ActionSwitch, Index: 0},
+		{Kind: battle.ActionSwitch, Index: 2},
+		{Kind: "run"},
+	}
+	for _, action := range invalid {
+		if err := b.Validate(0, action); err != battle.ErrInvalidAction {
+			t.Fatalf("expected %+v to be invalid, got %v", action, err)
+		}
+	}
+	if err := b.Play([2]battle.Action{{Kind: battle.ActionSwitch, Index: 1}, {Kind: battle.ActionMove}}); err != nil {
+		t.Fatalf("failed to switch: %s", err)
+	}
+	if b.Sides[0].Active != 1 {
+		t.Fatalf("expected the second pokemon to be active after switching")
+	}
+}
+
+func TestStatusMoveRespectsImmunity(t *testing.T) {
+	pikachu := models.Stats{HP: 35, Attack: 55, Defense: 40, SpecialAttack: 50, SpecialDefense: 50, Speed: 90}
+	teams := [2][]models.OwnedPokemon{
+		{testPokemon(1, "Pikachu", 50, pikachu, "electric")},
+		{testPokemon(2, "Raichu", 50, pikachu, "electric")},
+	}
+	b, err := battle.New(1, teams)
+	if err != nil {
+		t.Fatalf("failed to create battle: %s", err)
+	}
+	thunderWave := -1
+	for i, move := range b.Sides[0].Team[0].Moves {
+		if move.Name == "thunder-wave" {
+			thunderWave = i
+		}
+	}
+	if thunderWave == -1 {
+		t.Fatalf("expected an electric pokemon to know thunder-wave")
+	}
+	for i := 0; i < 10; i++ {
+		actions := [2]battle.Action{{Kind: battle.ActionMove, Index: thunderWave}, {Kind: battle.ActionMove, Index: thunderWave}}
+		if err := b.Play(actions); err != nil {
+			t.Fatalf("playing turn failed: %s", err)
+		}
+	}
+	for _, side := range b.Sides {
+		if condition := side.Team[0].Condition; condition != "" {
+			t.Fatalf("electric pokemon got %s", condition)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package battle
+
+import "susie.mx/gokemon/models"
+
+type Category string
+
+const (
+	Physical Category = "physical"
+	Special  Category = "special"
+	Status   Category = "status"
+)
+
+type Move struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Category Category `json:"category"`
+	Power    uint     `json:"power"`
+	// Percent chance to hit
+	Accuracy uint `json:"accuracy"`
+	Priority int  `json:"priority"`
+	// The condition the move causes in its target, with StatusChance percent
+	// probability for damaging moves
+	Causes       Condition `json:"causes,omitempty"`
+	StatusChance uint      `json:"statusChance,omitempty"`
+}
+
+var Moves = map[string]Move{
+	"tackle":        {"tackle", "normal", Physical, 40, 100, 0, "", 0},
+	"quick-attack":  {"quick-attack", "normal", Physical, 40, 100, 1, "", 0},
+	"body-slam":     {"body-slam", "normal", Physical, 85, 100, 0, Paralysis, 30},
+	"hyper-voice":   {"hyper-voice", "normal", Special, 90, 100, 0, "", 0},
+	"fire-punch":    {"fire-punch", "fire", Physical, 75, 100, 0, Burn, 10},
+	"flamethrower":  {"flamethrower", "fire", Special, 90, 100, 0, Burn, 10},
+	"waterfall":     {"waterfall", "water", Physical, 80, 100, 0, "", 0},
+	"surf":          {"surf", "water", Special, 90, 100, 0, "", 0},
+	"thunder-punch": {"thunder-punch", "electric", Physical, 75, 100, 0, Paralysis, 10},
+	"thunderbolt":   {"thunderbolt", "electric", Special, 90, 100, 0, Paralysis, 10},
+	"leaf-blade":    {"leaf-blade", "grass", Physical, 90, 100, 0, "", 0},
+	"energy-ball":   {"energy-ball", "grass", Special, 90, 100, 0, "", 0},
+	"ice-punch":     {"ice-punch", "ice", Physical, 75, 100, 0, Freeze, 10},
+	"ice-beam":      {"ice-beam", "ice", Special, 90, 100, 0, Freeze, 10},
+	"brick-break":   {"brick-break", "fighting", Physical, 75, 100, 0, "", 0},
+	"aura-sphere":   {"aura-sphere", "fighting", Special, 80, 100, 0, "", 0},
+	"poison-jab":    {"poison-jab", "poison", Physical, 80, 100, 0, Poison, 30},
+	"sludge-bomb":   {"sludge-bomb", "poison", Special, 90, 100, 0, Poison, 30},
+	"earthquake":    {"earthquake", "ground", Physical, 100, 100, 0, "", 0},
+	"earth-power":   {"earth-power", "ground", Special, 90, 100, 0, "", 0},
+	"drill-peck":    {"drill-peck", "flying", Physical, 80, 100, 0, "", 0},
+	"air-slash":     {"air-slash", "flying", Special, 75, 95, 0, "", 0},
+	"zen-headbutt":  {"zen-headbutt", "psychic", Physical, 80, 90, 0, "", 0},
+	"psychic":       {"psychic", "psychic", Special, 90, 100, 0, "", 0},
+	"x-scissor":     {"x-scissor", "bug", Physical, 80, 100, 0, "", 0},
+	"bug-buzz":      {"bug-buzz", "bug", Special, 90, 100, 0, "", 0},
+	"rock-slide":    {"rock-slide", "rock", Physical, 75, 90, 0, "", 0},
+	"power-gem":     {"power-gem", "rock", Special, 80, 100, 0, "", 0},
+	"shadow-claw":   {"shadow-claw", "ghost", Physical, 70, 100, 0, "", 0},
+	"shadow-ball":   {"shadow-ball", "ghost", Special, 80, 100, 0, "", 0},
+	"dragon-claw":   {"dragon-claw", "dragon", Physical, 80, 100, 0, "", 0},
+	"dragon-pulse":  {"dragon-pulse", "dragon", Special, 85, 100, 0, "", 0},
+	"crunch":        {"crunch", "dark", Physical, 80, 100, 0, "", 0},
+	"dark-pulse":    {"dark-pulse", "dark", Special, 80, 100, 0, "", 0},
+	"iron-head":     {"iron-head", "steel", Physical, 80, 100, 0, "", 0},
+	"flash-cannon":  {"flash-cannon", "steel", Special, 80, 100, 0, "", 0},
+	"play-rough":    {"play-rough", "fairy", Physical, 90, 90, 0, "", 0},
+	"moonblast":     {"moonblast", "fairy", Special, 95, 100, 0, "", 0},
+	"thunder-wave":  {"thunder-wave", "electric", Status, 0, 90, 0, Paralysis, 0},
+	"will-o-wisp":   {"will-o-wisp", "fire", Status, 0, 85, 0, Burn, 0},
+	"toxic":         {"toxic", "poison", Status, 0, 90, 0, Poison, 0},
+	"hypnosis":      {"hypnosis", "psychic", Status, 0, 60, 0, Sleep, 0},
+}
+
+// typeMoves are the physical and special moves a pokemon learns for each of
+// its types
+var typeMoves = map[string][2]string{
+	"normal":   {"body-slam", "hyper-voice"},
+	"fire":     {"fire-punch", "flamethrower"},
+	"water":    {"waterfall", "surf"},
+	"electric": {"thunder-punch", "thunderbolt"},
+	"grass":    {"leaf-blade", "energy-ball"},
+	"ice":      {"ice-punch", "ice-beam"},
+	"fighting": {"brick-break", "aura-sphere"},
+	"poison":   {"poison-jab", "sludge-bomb"},
+	"ground":   {"earthquake", "earth-power"},
+	"flying":   {"drill-peck", "air-slash"},
+	"psychic":  {"zen-headbutt", "psychic"},
+	"bug":      {"x-scissor", "bug-buzz"},
+	"rock":     {"rock-slide", "power-gem"},
+	"ghost":    {"shadow-claw", "shadow-ball"},
+	"dragon":   {"dragon-claw", "dragon-pulse"},
+	"dark":     {"crunch", "dark-pulse"},
+	"steel":    {"iron-head", "flash-cannon"},
+	"fairy":    {"play-rough", "moonblast"},
+}
+
+var typeStatusMoves = map[string]string{
+	"electric": "thunder-wave",
+	"fire":     "will-o-wisp",
+	"poison":   "toxic",
+	"psychic":  "hypnosis",
+}
+
+const MaxMoves = 4
+
+// MoveSet picks up to MaxMoves moves for a pokemon, since pokemon do not learn
+// moves yet. It prefers moves of its own types in its stronger attacking
+// category.
+func MoveSet(types []string, stats models.Stats) []Move {
+	preferred, other := 0, 1
+	if stats.SpecialAttack > stats.Attack {
+		preferred, other = 1, 0
+	}
+	var names []string
+	add := func(name string) {
+		for _, n := range names {
+			if n == name {
+				return
+			}
+		}
+		if len(names) < MaxMoves {
+			names = append(names, name)
+		}
+	}
+	for _, t := range types {
+		if moves, ok := typeMoves[t]; ok {
+			add(moves[preferred])
+		}
+	}
+	add("quick-attack")
+	for _, t := range types {
+		if move, ok := typeStatusMoves[t]; ok {
+			add(move)
+		}
+	}
+	for _, t := range types {
+		if moves, ok := typeMoves[t]; ok {
+			add(moves[other])
+		}
+	}
+	add("tackle")
+	moves := make([]Move, len(names))
+	for i, name := range names {
+		moves[i] = Moves[name]
+	}
+	return moves
+}
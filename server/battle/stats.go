@@ -0,0 +1,31 @@
+package battle
+
+import "susie.mx/gokemon/models"
+
+// CalcStats computes a pokemon's stats the way the games do for a pokemon
+// without effort values
+func CalcStats(base models.Stats, ivs models.Stats, level uint, natureName string) models.Stats {
+	nature, ok := models.FindNature(natureName)
+	if !ok {
+		nature = models.Natures[0]
+	}
+	stat := func(name string, base uint, iv uint) uint {
+		value := (2*base+iv)*level/100 + 5
+		switch {
+		case nature.Increased == nature.Decreased:
+		case nature.Increased == name:
+			value = value * 110 / 100
+		case nature.Decreased == name:
+			value = value * 90 / 100
+		}
+		return value
+	}
+	return models.Stats{
+		HP:             (2*base.HP+ivs.HP)*level/100 + level + 10,
+		Attack:         stat(models.StatAttack, base.Attack, ivs.Attack),
+		Defense:        stat(models.StatDefense, base.Defense, ivs.Defense),
+		SpecialAttack:  stat(models.StatSpecialAttack, base.SpecialAttack, ivs.SpecialAttack),
+		SpecialDefense: stat(models.StatSpecialDefense, base.SpecialDefense, ivs.SpecialDefense),
+		Speed:          stat(models.StatSpeed, base.Speed, ivs.Speed),
+	}
+}
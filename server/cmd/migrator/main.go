@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"susie.mx/gokemon/models"
+	"susie.mx/gokemon/server"
 )
 
 func main() {
@@ -24,9 +27,46 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to connect database: %s", err)
 	}
-	_ = db
 
 	// migratePokemonToOwnedPokemon(db)
+	migrateTradesToPokemonSets(db)
+	migrateTradeRequestExpiry(db)
+	migrateOwnedPokemonToPokedex(db)
+	migratePokemonGenerations(db)
+	migrateOwnedPokemonToOwnershipRecords(db)
+}
+
+func migrateTradesToPokemonSets(db *gorm.DB) {
+	if err := db.AutoMigrate(&models.TradeRequest{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.Trade{}); err != nil {
+		log.Fatalln(err)
+	}
+	for _, table := range []string{"trade_requests", "trades"} {
+		if !db.Migrator().HasColumn(table, "user_pokemon_id") {
+			continue
+		}
+		singular := table[:len(table)-1]
+		statements := []string{
+			fmt.Sprintf("INSERT INTO %s_user_pokemon (%s_id, owned_pokemon_id) SELECT id, user_pokemon_id FROM %s ON CONFLICT DO NOTHING", singular, singular, table),
+			fmt.Sprintf("INSERT INTO %s_friend_pokemon (%s_id, owned_pokemon_id) SELECT id, friend_pokemon_id FROM %s ON CONFLICT DO NOTHING", singular, singular, table),
+		}
+		if table == "trade_requests" {
+			statements = append(statements, "UPDATE trade_requests SET thread_id = id WHERE thread_id IS NULL OR thread_id = 0")
+		}
+		for _, statement := range statements {
+			if err := db.Exec(statement).Error; err != nil {
+				log.Fatalln(err)
+			}
+		}
+		if err := db.Migrator().DropColumn(table, "user_pokemon_id"); err != nil {
+			log.Fatalln(err)
+		}
+		if err := db.Migrator().DropColumn(table, "friend_pokemon_id"); err != nil {
+			log.Fatalln(err)
+		}
+	}
 }
 
 // func migratePokemonToOwnedPokemon(db *gorm.DB) {
@@ -49,3 +89,81 @@ func main() {
 // 		}
 // 	}
 // }
+
+func migrateTradeRequestExpiry(db *gorm.DB) {
+	if err := db.AutoMigrate(&models.TradeRequest{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.Job{}); err != nil {
+		log.Fatalln(err)
+	}
+	expiresAt := time.Now().Add(server.DefaultTradeRequestExpiry).UnixMilli()
+	err := db.Model(&models.TradeRequest{}).
+		Where("status = ? AND (expires_at IS NULL OR expires_at = 0)", models.TradeRequestOpen).
+		Update("expires_at", expiresAt).Error
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = db.Exec(`INSERT INTO jobs (kind, subject_id, run_at, attempts, last_error)
+		SELECT ?, id, expires_at, 0, '' FROM trade_requests WHERE status = ?
+		ON CONFLICT DO NOTHING`, server.ExpireTradeRequestJob, models.TradeRequestOpen).Error
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func migrateOwnedPokemonToPokedex(db *gorm.DB) {
+	if err := db.AutoMigrate(&models.PokedexEntry{}); err != nil {
+		log.Fatalln(err)
+	}
+	err := db.Exec(`INSERT INTO pokedex_entries (user_id, pokemon_id, form_index, is_shiny, is_caught, first_seen_at, first_caught_at)
+		SELECT DISTINCT owner_id, pokemon_id, form_index, is_shiny, true, 0, 0 FROM owned_pokemons WHERE owner_id IS NOT NULL
+		ON CONFLICT DO NOTHING`).Error
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = db.Exec(`INSERT INTO pokedex_entries (user_id, pokemon_id, form_index, is_shiny, is_caught, first_seen_at, first_caught_at)
+		SELECT DISTINCT pending_owner_id, pokemon_id, form_index, is_shiny, false, 0, 0 FROM owned_pokemons WHERE pending_owner_id IS NOT NULL
+		ON CONFLICT DO NOTHING`).Error
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// lastPokemonOfGeneration holds the highest national dex number introduced in
+// each generation, in order
+var lastPokemonOfGeneration = []uint{151, 251, 386, 493, 649, 721, 809, 898}
+
+// migratePokemonGenerations fills in the generation of pokemon scraped before
+// it was imported, which the scraper sets from now on
+func migratePokemonGenerations(db *gorm.DB) {
+	if err := db.AutoMigrate(&models.Pokemon{}); err != nil {
+		log.Fatalln(err)
+	}
+	first := uint(1)
+	for i, last := range lastPokemonOfGeneration {
+		err := db.Model(&models.Pokemon{}).
+			Where("(generation IS NULL OR generation = 0) AND id BETWEEN ? AND ?", first, last).
+			Update("generation", i+1).Error
+		if err != nil {
+			log.Fatalln(err)
+		}
+		first = last + 1
+	}
+}
+
+// migrateOwnedPokemonToOwnershipRecords gives pokemon owned from before
+// ownership was recorded a record of being caught by their owner, so they count
+// towards achievements
+func migrateOwnedPokemonToOwnershipRecords(db *gorm.DB) {
+	if err := db.AutoMigrate(&models.OwnershipRecord{}); err != nil {
+		log.Fatalln(err)
+	}
+	err := db.Exec(`INSERT INTO ownership_records (owned_pokemon_id, owner_id, method, acquired_at)
+		SELECT id, owner_id, ?, caught_at FROM owned_pokemons WHERE owner_id IS NOT NULL
+		AND NOT EXISTS (SELECT 1 FROM ownership_records WHERE ownership_records.owned_pokemon_id = owned_pokemons.id)`,
+		models.AcquiredByCatching).Error
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
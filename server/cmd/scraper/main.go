@@ -15,8 +15,9 @@ import (
 const MAX_POKEMON_ID = 898
 
 type species struct {
-	pokemon models.Pokemon
-	forms   []models.PokemonForm
+	pokemon          models.Pokemon
+	forms            []models.PokemonForm
+	evolutionChainID int
 }
 
 func main() {
@@ -38,10 +39,14 @@ func main() {
 	db.Migrator().DropTable(&models.PokemonForm{})
 	db.Migrator().DropTable(&models.Sprites{})
 	db.Migrator().DropTable(&models.Type{})
+	db.Migrator().DropTable(&models.Evolution{})
+	db.Migrator().DropTable(&models.PokemonAbility{})
 	db.AutoMigrate(&models.Pokemon{})
 	db.AutoMigrate(&models.PokemonForm{})
 	db.AutoMigrate(&models.Sprites{})
 	db.AutoMigrate(&models.Type{})
+	db.AutoMigrate(&models.Evolution{})
+	db.AutoMigrate(&models.PokemonAbility{})
 
 	speciesChans := []chan species{}
 
@@ -56,14 +61,27 @@ func main() {
 			if err != nil {
 				log.Fatalln(err)
 			}
+			generation, err := pokemonSpecies.Generation.ID()
+			if err != nil {
+				log.Fatalln(err)
+			}
 			var species species
 			species.pokemon = models.Pokemon{
 				ID:                   uint(pokemonSpecies.ID),
 				HasGenderDifferences: pokemonSpecies.HasGenderDifferences,
 				IsLegendary:          pokemonSpecies.IsLegendary,
 				IsMythical:           pokemonSpecies.IsMythical,
+				Generation:           uint(generation),
+				GenderRate:           &pokemonSpecies.GenderRate,
 				Forms:                []models.PokemonForm{},
 			}
+			if pokemonSpecies.Habitat != nil {
+				species.pokemon.Habitat = pokemonSpecies.Habitat.Name
+			}
+			species.evolutionChainID, err = pokemonSpecies.EvolutionChain.ID()
+			if err != nil {
+				log.Fatalln(err)
+			}
 			for _, name := range pokemonSpecies.Names {
 				if name.Language.Name == "en" {
 					species.pokemon.Name = name.Name
@@ -92,6 +110,7 @@ func main() {
 
 			for i := range pokemonSpecies.Varieties {
 				pokemonVariety := <-pokemonChans[i]
+				baseStats := toStats(pokemonVariety)
 				pokemonFormChans := []chan pokeapi.PokemonForm{}
 
 				for _, form := range pokemonVariety.Forms {
@@ -139,6 +158,8 @@ func main() {
 							FrontShiny:       pokemonForm.Sprites.FrontShiny,
 							FrontShinyFemale: pokemonForm.Sprites.FrontShinyFemale,
 						},
+						BaseStats: baseStats,
+						Abilities: toAbilities(pokemonVariety),
 					})
 				}
 			}
@@ -147,12 +168,147 @@ func main() {
 		}(id)
 	}
 
+	evolutionChainIDs := map[int]bool{}
 	for id := 1; id <= MAX_POKEMON_ID; id++ {
 		species := <-speciesChans[id-1]
 		db.Create(&species.pokemon)
 		for _, form := range species.forms {
 			db.Create(&form)
 		}
+		evolutionChainIDs[species.evolutionChainID] = true
 		fmt.Printf("finished %d\n", id)
 	}
+
+	evolutionChans := []chan []models.Evolution{}
+	for chainID := range evolutionChainIDs {
+		evolutionChan := make(chan []models.Evolution)
+		evolutionChans = append(evolutionChans, evolutionChan)
+		go func(chainID int) {
+			chain, err := pokeapi.GetEvolutionChain(fmt.Sprintf("%d", chainID))
+			if err != nil {
+				log.Fatalln(err)
+			}
+			evolutions, err := chainEvolutions(chain.Chain)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			evolutionChan <- evolutions
+		}(chainID)
+	}
+	for _, evolutionChan := range evolutionChans {
+		for _, evolution := range <-evolutionChan {
+			db.Create(&evolution)
+		}
+	}
+	fmt.Printf("finished %d evolution chains\n", len(evolutionChans))
+}
+
+// chainEvolutions flattens an evolution chain into the ways each species in it
+// can evolve, leaving out species that are not scraped
+func chainEvolutions(link pokeapi.ChainLink) ([]models.Evolution, error) {
+	var evolutions []models.Evolution
+	from, err := link.Species.ID()
+	if err != nil {
+		return nil, err
+	}
+	for _, next := range link.EvolvesTo {
+		to, err := next.Species.ID()
+		if err != nil {
+			return nil, err
+		}
+		if from <= MAX_POKEMON_ID && to <= MAX_POKEMON_ID {
+			for _, detail := range next.EvolutionDetails {
+				evolution, err := toEvolution(uint(from), uint(to), detail)
+				if err != nil {
+					return nil, err
+				}
+				evolutions = append(evolutions, evolution)
+			}
+		}
+		nextEvolutions, err := chainEvolutions(next)
+		if err != nil {
+			return nil, err
+		}
+		evolutions = append(evolutions, nextEvolutions...)
+	}
+	return evolutions, nil
+}
+
+func toEvolution(from uint, to uint, detail pokeapi.EvolutionDetail) (models.Evolution, error) {
+	evolution := models.Evolution{
+		FromPokemonID: from,
+		ToPokemonID:   to,
+		Trigger:       detail.Trigger.Name,
+		MinLevel:      toUint(detail.MinLevel),
+		MinHappiness:  toUint(detail.MinHappiness),
+		TimeOfDay:     detail.TimeOfDay,
+		Gender:        toUint(detail.Gender),
+		HasOtherRequirements: detail.MinAffection != nil ||
+			detail.MinBeauty != nil ||
+			detail.KnownMove != nil ||
+			detail.KnownMoveType != nil ||
+			detail.Location != nil ||
+			detail.PartySpecies != nil ||
+			detail.PartyType != nil ||
+			detail.RelativePhysicalStats != nil ||
+			detail.NeedsOverworldRain ||
+			detail.TurnUpsideDown,
+	}
+	if detail.Item != nil {
+		evolution.Item = detail.Item.Name
+	}
+	if detail.HeldItem != nil {
+		evolution.HeldItem = detail.HeldItem.Name
+	}
+	if detail.TradeSpecies != nil {
+		id, err := detail.TradeSpecies.ID()
+		if err != nil {
+			return models.Evolution{}, err
+		}
+		tradeSpeciesID := uint(id)
+		evolution.TradeSpeciesID = &tradeSpeciesID
+	}
+	return evolution, nil
+}
+
+func toStats(pokemon pokeapi.Pokemon) models.Stats {
+	var stats models.Stats
+	for _, stat := range pokemon.Stats {
+		value := uint(stat.BaseStat)
+		switch stat.Stat.Name {
+		case models.StatHP:
+			stats.HP = value
+		case models.StatAttack:
+			stats.Attack = value
+		case models.StatDefense:
+			stats.Defense = value
+		case models.StatSpecialAttack:
+			stats.SpecialAttack = value
+		case models.StatSpecialDefense:
+			stats.SpecialDefense = value
+		case models.StatSpeed:
+			stats.Speed = value
+		}
+	}
+	return stats
+}
+
+func toAbilities(pokemon pokeapi.Pokemon) []models.PokemonAbility {
+	var abilities []models.PokemonAbility
+	for _, ability := range pokemon.Abilities {
+		abilities = append(abilities, models.PokemonAbility{
+			Name:     ability.Ability.Name,
+			IsHidden: ability.IsHidden,
+			Slot:     uint(ability.Slot),
+		})
+	}
+	return abilities
+}
+
+func toUint(i *int) *uint {
+	if i == nil {
+		return nil
+	}
+	u := uint(*i)
+	return &u
 }
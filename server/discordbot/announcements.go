@@ -0,0 +1,65 @@
+package discordbot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"susie.mx/gokemon/models"
+)
+
+// AnnounceEvent is a scheduler handler that posts an event to the announcement
+// channel once it starts. Events that were deleted or have already ended are
+// not announced. The event is marked as announced before the message is sent,
+// so a failed send rolls the mark back and a retried job does not post twice.
+func (b *Bot) AnnounceEvent(tx *gorm.DB, job models.Job) error {
+	if b.announcementChannelID == "" {
+		return nil
+	}
+	var event models.Event
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("BoostedPokemon").First(&event, job.SubjectID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	now := time.Now().UnixMilli()
+	if event.AnnouncedAt != 0 || event.EndsAt <= now {
+		return nil
+	}
+	if err := tx.Model(&event).Update("announced_at", now).Error; err != nil {
+		return err
+	}
+	_, err = b.session.ChannelMessageSend(b.announcementChannelID, eventAnnouncement(event))
+	return err
+}
+
+func eventAnnouncement(event models.Event) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "**%s** has started!\n", event.Name)
+	if event.Description != "" {
+		fmt.Fprintf(&sb, "%s\n", event.Description)
+	}
+	boosted := []string{}
+	for _, p := range event.BoostedPokemon {
+		boosted = append(boosted, p.Name)
+	}
+	if event.BoostedType != "" {
+		boosted = append(boosted, event.BoostedType+" types")
+	}
+	if len(boosted) > 0 && event.SpawnMultiplier > 1 {
+		fmt.Fprintf(&sb, "Boosted: %s (x%g)\n", strings.Join(boosted, ", "), event.SpawnMultiplier)
+	}
+	if event.ShinyMultiplier > 1 {
+		fmt.Fprintf(&sb, "Shiny rate: x%g\n", event.ShinyMultiplier)
+	}
+	if event.NewPokemonIntervalMinutes > 0 {
+		fmt.Fprintf(&sb, "New Pokemon every %d minutes\n", event.NewPokemonIntervalMinutes)
+	}
+	fmt.Fprintf(&sb, "Ends <t:%d:R>", event.EndsAt/1000)
+	return sb.String()
+}
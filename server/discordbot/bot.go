@@ -9,20 +9,22 @@ import (
 )
 
 type Bot struct {
-	session  *discordgo.Session
-	guildIDs []string
-	db       *gorm.DB
+	session               *discordgo.Session
+	guildIDs              []string
+	announcementChannelID string
+	db                    *gorm.DB
 }
 
-func New(authToken string, guildIDs []string, db *gorm.DB) *Bot {
+func New(authToken string, guildIDs []string, announcementChannelID string, db *gorm.DB) *Bot {
 	session, err := discordgo.New("Bot " + authToken)
 	if err != nil {
 		log.Panicf("failed to create discord session: %v", err)
 	}
 	b := &Bot{
-		session:  session,
-		guildIDs: guildIDs,
-		db:       db,
+		session:               session,
+		guildIDs:              guildIDs,
+		announcementChannelID: announcementChannelID,
+		db:                    db,
 	}
 	session.AddHandler(func(s *discordgo.Session, r *discordgo.Ready) {
 		log.Printf("Logged in as: %s#%s", s.State.User.Username, s.State.User.Discriminator)
@@ -40,7 +42,6 @@ func (b *Bot) Start() {
 	if err != nil {
 		log.Panicf("failed to open discord session: %v", err)
 	}
-	defer b.session.Close()
 
 	for _, guildID := range b.guildIDs {
 		if guildID == "" {
@@ -56,3 +57,10 @@ func (b *Bot) Start() {
 	}
 	log.Println("Finished adding commands!")
 }
+
+// Stop closes the session opened by Start
+func (b *Bot) Stop() {
+	if err := b.session.Close(); err != nil {
+		log.Printf("closing discord session failed: %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+	"gorm.io/gorm"
+	"susie.mx/gokemon/achievements"
+	"susie.mx/gokemon/models"
+)
+
+func Achievements(s *discordgo.Session, i *discordgo.InteractionCreate, db *gorm.DB) {
+	var user models.User
+	db.Preload("Achievements").First(&user, "discord_id = ?", i.Member.User.ID)
+	var content string
+	if len(user.Achievements) == 0 {
+		content = "You have not earned any badges yet\n"
+	}
+	for _, achievement := range user.Achievements {
+		rule, ok := achievements.Find(achievement.AchievementID)
+		if !ok {
+			continue
+		}
+		content += fmt.Sprintf("%s - %s\n", rule.Name, rule.Description)
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+		},
+	})
+	if err != nil {
+		log.Printf("failed to respond to achievements: %v", err)
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// MaxMessageLength is the most characters Discord allows in a message
+const MaxMessageLength = 2000
+
 type Command struct {
 	Information *discordgo.ApplicationCommand
 	Handler     func(s *discordgo.Session, i *discordgo.InteractionCreate, db *gorm.DB)
@@ -18,4 +21,33 @@ var Commands = map[string]Command{
 		},
 		PendingPokemon,
 	},
+	"trade-suggestions": {
+		&discordgo.ApplicationCommand{
+			Name:        "trade-suggestions",
+			Description: "Find friends with Pokemon on your wishlist",
+		},
+		TradeSuggestions,
+	},
+	"achievements": {
+		&discordgo.ApplicationCommand{
+			Name:        "achievements",
+			Description: "List the badges you have earned",
+		},
+		Achievements,
+	},
+	"location": {
+		&discordgo.ApplicationCommand{
+			Name:        "location",
+			Description: "Show or change where you look for Pokemon",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Type:        discordgo.ApplicationCommandOptionString,
+					Name:        "location",
+					Description: "A region or habitat",
+					Choices:     locationChoices(),
+				},
+			},
+		},
+		Location,
+	},
 }
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+	"gorm.io/gorm"
+	"susie.mx/gokemon/encounter"
+	"susie.mx/gokemon/models"
+)
+
+const anywhere = "anywhere"
+
+func locationChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := []*discordgo.ApplicationCommandOptionChoice{
+		{Name: "Anywhere", Value: anywhere},
+	}
+	for _, location := range encounter.Locations {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+			Name:  location.Name,
+			Value: location.ID,
+		})
+	}
+	return choices
+}
+
+func Location(s *discordgo.Session, i *discordgo.InteractionCreate, db *gorm.DB) {
+	var user models.User
+	db.First(&user, "discord_id = ?", i.Member.User.ID)
+	var content string
+	options := i.ApplicationCommandData().Options
+	switch {
+	case user.ID == 0:
+		content = "Log in to Gokemon with Discord before choosing a location\n"
+	case len(options) == 0:
+		if location, ok := encounter.FindLocation(user.Location); ok {
+			content = fmt.Sprintf("You are looking for Pokemon in %s\n", location.Name)
+		} else {
+			content = "You are looking for Pokemon anywhere\n"
+		}
+	default:
+		id := options[0].StringValue()
+		if id == anywhere {
+			id = ""
+		}
+		location, ok := encounter.FindLocation(id)
+		if id != "" && !ok {
+			content = "Unknown location\n"
+			break
+		}
+		if err := db.Model(&user).Update("location", id).Error; err != nil {
+			log.Printf("failed to update location: %v", err)
+			content = "Could not change your location right now, try again later\n"
+		} else if ok {
+			content = fmt.Sprintf("You will now find more Pokemon from %s\n", location.Name)
+		} else {
+			content = "You will now find Pokemon from anywhere\n"
+		}
+	}
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+		},
+	})
+	if err != nil {
+		log.Printf("failed to respond to location: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/bwmarrin/discordgo"
+	"gorm.io/gorm"
+	"susie.mx/gokemon/models"
+	"susie.mx/gokemon/wishlist"
+)
+
+func TradeSuggestions(s *discordgo.Session, i *discordgo.InteractionCreate, db *gorm.DB) {
+	var user models.User
+	db.First(&user, "discord_id = ?", i.Member.User.ID)
+	var content string
+	suggestions, err := wishlist.Suggestions(db, user.ID)
+	if err != nil {
+		log.Printf("failed to get trade suggestions: %v", err)
+		content = "Could not find trade suggestions right now, try again later\n"
+	} else if len(suggestions) == 0 {
+		content = "None of your friends have anything on your wishlist\n"
+	}
+	var lines []string
+	for _, suggestion := range suggestions {
+		for _, p := range suggestion.Receive {
+			if suggestion.Spares[p.PokemonID] {
+				lines = append(lines, fmt.Sprintf("Your friend %s has a spare %s you want\n", suggestion.Friend.Username, p.Pokemon.Name))
+			} else {
+				lines = append(lines, fmt.Sprintf("Your friend %s has a %s you want\n", suggestion.Friend.Username, p.Pokemon.Name))
+			}
+		}
+		if suggestion.IsMutual() {
+			lines = append(lines, fmt.Sprintf("%s wants your %s, maybe you can trade!\n", suggestion.Friend.Username, suggestion.Give[0].Pokemon.Name))
+		}
+	}
+	// Suggestions are sorted best first, so the ones that do not fit in a
+	// message matter least. Room is kept for the line saying how many were left
+	// out.
+	reserved := len(fmt.Sprintf("...and %d more\n", len(lines)))
+	for i, line := range lines {
+		room := MaxMessageLength - len(content)
+		if i < len(lines)-1 {
+			room -= reserved
+		}
+		if len(line) > room {
+			content += fmt.Sprintf("...and %d more\n", len(lines)-i)
+			break
+		}
+		content += line
+	}
+	err = s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+		},
+	})
+	if err != nil {
+		log.Printf("failed to respond to trade-suggestions: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package encounter
+
+import "susie.mx/gokemon/models"
+
+const MaxIV = 31
+
+// HiddenAbilityRate is how often a pokemon has its species' hidden ability
+// instead of one of its regular ones
+const HiddenAbilityRate = 0.05
+
+type LevelRange struct {
+	Min uint `json:"min"`
+	Max uint `json:"max"`
+}
+
+var LevelRanges = map[Tier]LevelRange{
+	Common:    {Min: 2, Max: 30},
+	Legendary: {Min: 50, Max: 70},
+	Mythical:  {Min: 50, Max: 70},
+}
+
+// Attributes are what makes a caught pokemon different from others of its
+// species
+type Attributes struct {
+	Level   uint
+	Nature  string
+	IVs     models.Stats
+	Gender  uint
+	Ability string
+}
+
+// RollAttributes rolls the attributes of a freshly encountered pokemon of the
+// given species and form. p must have its forms' abilities loaded.
+func RollAttributes(rng Rand, p models.Pokemon, formIndex uint) Attributes {
+	levels := LevelRanges[TierOf(p)]
+	attributes := Attributes{
+		Level:  levels.Min + uint(intn(rng, int(levels.Max-levels.Min)+1)),
+		Nature: models.Natures[intn(rng, len(models.Natures))].Name,
+		IVs: models.Stats{
+			HP:             uint(intn(rng, MaxIV+1)),
+			Attack:         uint(intn(rng, MaxIV+1)),
+			Defense:        uint(intn(rng, MaxIV+1)),
+			SpecialAttack:  uint(intn(rng, MaxIV+1)),
+			SpecialDefense: uint(intn(rng, MaxIV+1)),
+			Speed:          uint(intn(rng, MaxIV+1)),
+		},
+	}
+	// Without a known gender rate the pokemon is left without a gender, rather
+	// than guessing one it may not be able to have
+	if p.GenderRate != nil {
+		attributes.Gender = RollGender(rng, *p.GenderRate)
+	}
+	if int(formIndex) < len(p.Forms) {
+		attributes.Ability = RollAbility(rng, p.Forms[formIndex].Abilities)
+	}
+	return attributes
+}
+
+// RollGender picks a gender from a PokeAPI gender rate, which is the chance of
+// being female in eighths or -1 for genderless species
+func RollGender(rng Rand, genderRate int) uint {
+	if genderRate < 0 {
+		return models.GenderGenderless
+	}
+	if rng.Float64() < float64(genderRate)/8 {
+		return models.GenderFemale
+	}
+	return models.GenderMale
+}
+
+// RollAbility picks one of the regular abilities, or the hidden ability at
+// HiddenAbilityRate. It returns "" if there are no abilities to pick from.
+func RollAbility(rng Rand, abilities []models.PokemonAbility) string {
+	var regular, hidden []models.PokemonAbility
+	for _, ability := range abilities {
+		if ability.IsHidden {
+			hidden = append(hidden, ability)
+		} else {
+			regular = append(regular, ability)
+		}
+	}
+	if len(hidden) > 0 && (len(regular) == 0 || rng.Float64() < HiddenAbilityRate) {
+		return hidden[intn(rng, len(hidden))].Name
+	}
+	if len(regular) == 0 {
+		return ""
+	}
+	return regular[intn(rng, len(regular))].Name
+}
+
+func intn(rng Rand, n int) int {
+	return int(rng.Float64()*float64(n)) % n
+}
@@ -0,0 +1,83 @@
+package encounter_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"susie.mx/gokemon/encounter"
+	"susie.mx/gokemon/models"
+)
+
+func TestRollAttributes(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	genderless := -1
+	legendary := models.Pokemon{ID: 150, IsLegendary: true, GenderRate: &genderless, Forms: []models.PokemonForm{{
+		Abilities: []models.PokemonAbility{{Name: "pressure", Slot: 1}, {Name: "unnerve", IsHidden: true, Slot: 3}},
+	}}}
+	for i := 0; i < 1000; i++ {
+		attributes := encounter.RollAttributes(rng, legendary, 0)
+		if attributes.Level < 50 || attributes.Level > 70 {
+			t.Fatalf("legendary rolled level %d", attributes.Level)
+		}
+		if _, ok := models.FindNature(attributes.Nature); !ok {
+			t.Fatalf("rolled unknown nature '%s'", attributes.Nature)
+		}
+		if attributes.IVs.HP > encounter.MaxIV || attributes.IVs.Speed > encounter.MaxIV {
+			t.Fatalf("rolled IVs out of range: %+v", attributes.IVs)
+		}
+		if attributes.Gender != models.GenderGenderless {
+			t.Fatalf("genderless species rolled gender %d", attributes.Gender)
+		}
+		if attributes.Ability != "pressure" && attributes.Ability != "unnerve" {
+			t.Fatalf("rolled ability '%s' the species does not have", attributes.Ability)
+		}
+	}
+}
+
+func TestRollAttributesUnknownGenderRate(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	p := models.Pokemon{ID: 25, Forms: []models.PokemonForm{{}}}
+	for i := 0; i < 100; i++ {
+		if gender := encounter.RollAttributes(rng, p, 0).Gender; gender != models.GenderNone {
+			t.Fatalf("species without a gender rate rolled gender %d", gender)
+		}
+	}
+}
+
+func TestRollGender(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		if gender := encounter.RollGender(rng, 0); gender != models.GenderMale {
+			t.Fatalf("male only species rolled gender %d", gender)
+		}
+		if gender := encounter.RollGender(rng, 8); gender != models.GenderFemale {
+			t.Fatalf("female only species rolled gender %d", gender)
+		}
+	}
+	females := 0
+	for i := 0; i < 10000; i++ {
+		if encounter.RollGender(rng, 1) == models.GenderFemale {
+			females++
+		}
+	}
+	if females < 1000 || females > 1500 {
+		t.Fatalf("expected about 1 in 8 to be female, got %d in 10000", females)
+	}
+}
+
+func TestRollAbilityHidden(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	abilities := []models.PokemonAbility{{Name: "overgrow", Slot: 1}, {Name: "chlorophyll", IsHidden: true, Slot: 3}}
+	hidden := 0
+	for i := 0; i < 10000; i++ {
+		if encounter.RollAbility(rng, abilities) == "chlorophyll" {
+			hidden++
+		}
+	}
+	if hidden < 300 || hidden > 700 {
+		t.Fatalf("expected the hidden ability about 5%% of the time, got %d in 10000", hidden)
+	}
+	if ability := encounter.RollAbility(rng, nil); ability != "" {
+		t.Fatalf("expected no ability without any to pick from, got '%s'", ability)
+	}
+}
@@ -0,0 +1,55 @@
+package encounter
+
+import "susie.mx/gokemon/models"
+
+// A ChainBonus applies to the species a user has selected MinLength times in a
+// row, similar to catch combos in the games
+type ChainBonus struct {
+	MinLength       uint    `json:"minLength"`
+	SpawnMultiplier float64 `json:"spawnMultiplier"`
+	ShinyMultiplier float64 `json:"shinyMultiplier"`
+}
+
+// ChainBonuses must be ordered by MinLength
+var ChainBonuses = []ChainBonus{
+	{MinLength: 0, SpawnMultiplier: 1, ShinyMultiplier: 1},
+	{MinLength: 3, SpawnMultiplier: 2, ShinyMultiplier: 1.5},
+	{MinLength: 6, SpawnMultiplier: 3, ShinyMultiplier: 2},
+	{MinLength: 11, SpawnMultiplier: 4, ShinyMultiplier: 3},
+	{MinLength: 21, SpawnMultiplier: 5, ShinyMultiplier: 4},
+}
+
+func ChainBonusFor(length uint) ChainBonus {
+	bonus := ChainBonuses[0]
+	for _, b := range ChainBonuses {
+		if length >= b.MinLength {
+			bonus = b
+		}
+	}
+	return bonus
+}
+
+func ChainModifier(pokemonID uint, bonus ChainBonus) Modifier {
+	return func(p models.Pokemon) float64 {
+		if p.ID == pokemonID {
+			return bonus.SpawnMultiplier
+		}
+		return 1
+	}
+}
+
+// RollShinies decides which pokemon of a batch are shiny, given each one's
+// shiny rate. If guaranteed is set and none of them rolled shiny, one of them
+// is made shiny at random.
+func RollShinies(rng Rand, rates []float64, guaranteed bool) []bool {
+	shinies := make([]bool, len(rates))
+	anyShiny := false
+	for i, rate := range rates {
+		shinies[i] = rng.Float64() < rate
+		anyShiny = anyShiny || shinies[i]
+	}
+	if guaranteed && !anyShiny && len(shinies) > 0 {
+		shinies[int(rng.Float64()*float64(len(shinies)))%len(shinies)] = true
+	}
+	return shinies
+}
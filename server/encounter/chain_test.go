@@ -0,0 +1,58 @@
+package encounter_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"susie.mx/gokemon/encounter"
+)
+
+func TestChainBonusFor(t *testing.T) {
+	if bonus := encounter.ChainBonusFor(0); bonus.SpawnMultiplier != 1 || bonus.ShinyMultiplier != 1 {
+		t.Fatalf("expected no bonus without a chain, got %+v", bonus)
+	}
+	longest := encounter.ChainBonuses[len(encounter.ChainBonuses)-1]
+	if bonus := encounter.ChainBonusFor(longest.MinLength + 100); bonus != longest {
+		t.Fatalf("expected the largest bonus for a long chain, got %+v", bonus)
+	}
+	for i := 1; i < len(encounter.ChainBonuses); i++ {
+		prev, next := encounter.ChainBonuses[i-1], encounter.ChainBonuses[i]
+		if bonus := encounter.ChainBonusFor(next.MinLength - 1); bonus != prev {
+			t.Fatalf("chain of %d got %+v, expected %+v", next.MinLength-1, bonus, prev)
+		}
+	}
+}
+
+func TestChainModifier(t *testing.T) {
+	table, err := encounter.NewTable(testPokemon(), encounter.DefaultConfig)
+	if err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+	counts := draw(t, table, encounter.ChainModifier(25, encounter.ChainBonus{SpawnMultiplier: 10}))
+	if ratio := float64(counts[25]) / float64(counts[1]); ratio < 7 || ratio > 13 {
+		t.Fatalf("chained species drawn %d times vs %d", counts[25], counts[1])
+	}
+}
+
+func TestRollShiniesGuaranteed(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		shinies := encounter.RollShinies(rng, []float64{0, 0, 0}, true)
+		numShiny := 0
+		for _, isShiny := range shinies {
+			if isShiny {
+				numShiny++
+			}
+		}
+		if numShiny != 1 {
+			t.Fatalf("expected exactly one guaranteed shiny, got %v", shinies)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		for _, isShiny := range encounter.RollShinies(rng, []float64{0, 0, 0}, false) {
+			if isShiny {
+				t.Fatalf("rolled a shiny with a zero rate")
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package encounter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sync"
+
+	"susie.mx/gokemon/models"
+)
+
+type Tier string
+
+const (
+	Common    Tier = "common"
+	Legendary Tier = "legendary"
+	Mythical  Tier = "mythical"
+)
+
+func TierOf(p models.Pokemon) Tier {
+	switch {
+	case p.IsMythical:
+		return Mythical
+	case p.IsLegendary:
+		return Legendary
+	default:
+		return Common
+	}
+}
+
+// Config describes how likely each pokemon is to be encountered. A species'
+// weight comes from its tier unless it has an explicit species weight, and
+// its forms are equally likely unless form weights are given for it.
+type Config struct {
+	TierWeights    map[Tier]float64   `json:"tierWeights"`
+	SpeciesWeights map[uint]float64   `json:"speciesWeights"`
+	FormWeights    map[uint][]float64 `json:"formWeights"`
+}
+
+var DefaultConfig = Config{
+	TierWeights: map[Tier]float64{
+		Common:    100,
+		Legendary: 2,
+		Mythical:  1,
+	},
+}
+
+func LoadConfig(path string) (Config, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("reading encounter config(%s) failed: %w", path, err)
+	}
+	var config Config
+	if err := json.Unmarshal(bs, &config); err != nil {
+		return Config{}, fmt.Errorf("decoding encounter config(%s) failed: %w", path, err)
+	}
+	if config.TierWeights == nil {
+		config.TierWeights = DefaultConfig.TierWeights
+	}
+	return config, nil
+}
+
+// Rand is the source of randomness for encounters. *rand.Rand satisfies it,
+// which lets tests use a seeded generator.
+type Rand interface {
+	Float64() float64
+}
+
+type globalRand struct{}
+
+func (globalRand) Float64() float64 {
+	return rand.Float64()
+}
+
+// GlobalRand draws from math/rand's shared, concurrency safe source
+var GlobalRand Rand = globalRand{}
+
+// A Modifier scales the weight of a species, e.g. to boost it during an event
+type Modifier func(p models.Pokemon) float64
+
+type Entry struct {
+	Pokemon     models.Pokemon
+	Weight      float64
+	FormWeights []float64
+}
+
+type Table struct {
+	entries []Entry
+	weights []float64
+}
+
+var ErrEmptyTable = errors.New("encounter table has no pokemon with a positive weight")
+
+func NewTable(pokemon []models.Pokemon, config Config) (*Table, error) {
+	table := &Table{}
+	total := 0.0
+	for _, p := range pokemon {
+		if len(p.Forms) == 0 {
+			continue
+		}
+		weight, ok := config.SpeciesWeights[p.ID]
+		if !ok {
+			weight = config.TierWeights[TierOf(p)]
+		}
+		if weight <= 0 {
+			continue
+		}
+		formWeights := make([]float64, len(p.Forms))
+		for i := range formWeights {
+			formWeights[i] = 1
+		}
+		if weights, ok := config.FormWeights[p.ID]; ok {
+			for i := range formWeights {
+				formWeights[i] = 0
+				if i < len(weights) && weights[i] > 0 {
+					formWeights[i] = weights[i]
+				}
+			}
+			if sum(formWeights) == 0 {
+				continue
+			}
+		}
+		table.entries = append(table.entries, Entry{
+			Pokemon:     p,
+			Weight:      weight,
+			FormWeights: formWeights,
+		})
+		table.weights = append(table.weights, weight)
+		total += weight
+	}
+	if total == 0 {
+		return nil, ErrEmptyTable
+	}
+	return table, nil
+}
+
+func (t *Table) Entries() []Entry {
+	return t.entries
+}
+
+// Pick draws a pokemon and the index of one of its forms. If the modifiers
+// leave no pokemon with a positive weight they are ignored.
+func (t *Table) Pick(rng Rand, modifiers ...Modifier) (models.Pokemon, uint) {
+	if len(modifiers) == 0 {
+		entry := t.entries[pickIndex(rng, t.weights)]
+		return entry.Pokemon, uint(pickIndex(rng, entry.FormWeights))
+	}
+	weights := make([]float64, len(t.entries))
+	for i, entry := range t.entries {
+		weights[i] = entry.Weight
+		for _, modifier := range modifiers {
+			weights[i] *= modifier(entry.Pokemon)
+		}
+		if weights[i] < 0 {
+			weights[i] = 0
+		}
+	}
+	if sum(weights) == 0 {
+		weights = t.weights
+	}
+	entry := t.entries[pickIndex(rng, weights)]
+	return entry.Pokemon, uint(pickIndex(rng, entry.FormWeights))
+}
+
+func pickIndex(rng Rand, weights []float64) int {
+	target := rng.Float64() * sum(weights)
+	for i, weight := range weights {
+		if target < weight {
+			return i
+		}
+		target -= weight
+	}
+	// Floating point error can leave target just past the last positive weight
+	for i := len(weights) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
+
+func sum(weights []float64) float64 {
+	total := 0.0
+	for _, weight := range weights {
+		total += weight
+	}
+	return total
+}
+
+// Store holds the active encounter table so that it can be swapped while the
+// server is running.
+type Store struct {
+	mu    sync.RWMutex
+	table *Table
+}
+
+func (s *Store) Table() *Table {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.table
+}
+
+func (s *Store) Swap(table *Table) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.table = table
+}
@@ -0,0 +1,156 @@
+package encounter_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"susie.mx/gokemon/encounter"
+	"susie.mx/gokemon/models"
+)
+
+const numDraws = 100000
+
+func testPokemon() []models.Pokemon {
+	var pokemon []models.Pokemon
+	for id := uint(1); id <= 898; id++ {
+		p := models.Pokemon{
+			ID:    id,
+			Forms: []models.PokemonForm{{Name: "default"}},
+		}
+		switch id {
+		case 150:
+			p.IsLegendary = true
+		case 151:
+			p.IsMythical = true
+		case 201:
+			p.Forms = append(p.Forms, models.PokemonForm{Name: "b"}, models.PokemonForm{Name: "c"})
+		}
+		pokemon = append(pokemon, p)
+	}
+	return pokemon
+}
+
+func draw(t *testing.T, table *encounter.Table, modifiers ...encounter.Modifier) map[uint]int {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1))
+	counts := map[uint]int{}
+	for i := 0; i < numDraws; i++ {
+		p, _ := table.Pick(rng, modifiers...)
+		counts[p.ID]++
+	}
+	return counts
+}
+
+func TestTierWeights(t *testing.T) {
+	table, err := encounter.NewTable(testPokemon(), encounter.Config{
+		TierWeights: map[encounter.Tier]float64{
+			encounter.Common:    100,
+			encounter.Legendary: 10,
+			encounter.Mythical:  0,
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+	counts := draw(t, table)
+	if counts[151] != 0 {
+		t.Fatalf("mythical with zero weight was drawn %d times", counts[151])
+	}
+	totalWeight := 896*100.0 + 10
+	expectedLegendary := numDraws * 10 / totalWeight
+	if math.Abs(float64(counts[150])-expectedLegendary) > 4*math.Sqrt(expectedLegendary) {
+		t.Fatalf("legendary drawn %d times, expected about %.1f", counts[150], expectedLegendary)
+	}
+	expectedCommon := numDraws * 100 / totalWeight
+	if math.Abs(float64(counts[1])-expectedCommon) > 4*math.Sqrt(expectedCommon) {
+		t.Fatalf("common drawn %d times, expected about %.1f", counts[1], expectedCommon)
+	}
+	if counts[898] == 0 {
+		t.Fatalf("last pokemon was never drawn")
+	}
+}
+
+func TestSpeciesWeights(t *testing.T) {
+	table, err := encounter.NewTable(testPokemon(), encounter.Config{
+		TierWeights:    encounter.DefaultConfig.TierWeights,
+		SpeciesWeights: map[uint]float64{25: 0, 150: 100},
+	})
+	if err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+	counts := draw(t, table)
+	if counts[25] != 0 {
+		t.Fatalf("pokemon with zero species weight was drawn %d times", counts[25])
+	}
+	if ratio := float64(counts[150]) / float64(counts[1]); ratio < 0.7 || ratio > 1.3 {
+		t.Fatalf("legendary with common species weight drawn %d times vs %d", counts[150], counts[1])
+	}
+}
+
+func TestFormWeights(t *testing.T) {
+	table, err := encounter.NewTable(testPokemon(), encounter.Config{
+		TierWeights:    encounter.DefaultConfig.TierWeights,
+		SpeciesWeights: map[uint]float64{},
+		FormWeights:    map[uint][]float64{201: {0, 3, 1}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+	onlyUnown := func(p models.Pokemon) float64 {
+		if p.ID == 201 {
+			return 1
+		}
+		return 0
+	}
+	rng := rand.New(rand.NewSource(1))
+	forms := map[uint]int{}
+	for i := 0; i < 10000; i++ {
+		p, formIndex := table.Pick(rng, onlyUnown)
+		if p.ID != 201 {
+			t.Fatalf("modifier did not restrict draws, got %d", p.ID)
+		}
+		forms[formIndex]++
+	}
+	if forms[0] != 0 {
+		t.Fatalf("form with zero weight was drawn %d times", forms[0])
+	}
+	if ratio := float64(forms[1]) / float64(forms[2]); ratio < 2.7 || ratio > 3.3 {
+		t.Fatalf("form weights 3:1 drawn %d:%d", forms[1], forms[2])
+	}
+}
+
+func TestModifiersFallBack(t *testing.T) {
+	table, err := encounter.NewTable(testPokemon(), encounter.DefaultConfig)
+	if err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+	none := func(p models.Pokemon) float64 { return 0 }
+	counts := draw(t, table, none)
+	if len(counts) < 800 {
+		t.Fatalf("expected modifiers that rule out everything to be ignored, drew %d species", len(counts))
+	}
+}
+
+func TestEmptyTable(t *testing.T) {
+	_, err := encounter.NewTable(testPokemon(), encounter.Config{})
+	if err != encounter.ErrEmptyTable {
+		t.Fatalf("expected empty table error, got %v", err)
+	}
+}
+
+func TestSeededDrawsAreDeterministic(t *testing.T) {
+	table, err := encounter.NewTable(testPokemon(), encounter.DefaultConfig)
+	if err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+	a := rand.New(rand.NewSource(42))
+	b := rand.New(rand.NewSource(42))
+	for i := 0; i < 100; i++ {
+		p1, f1 := table.Pick(a)
+		p2, f2 := table.Pick(b)
+		if p1.ID != p2.ID || f1 != f2 {
+			t.Fatalf("draw %d differed: %d/%d vs %d/%d", i, p1.ID, f1, p2.ID, f2)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package encounter
+
+import "susie.mx/gokemon/models"
+
+// LocationBoost is how much more likely pokemon native to a user's location
+// are to be encountered
+const LocationBoost = 20
+
+// A Location is a region, matching pokemon by generation, or a habitat. Only
+// species up to generation 3 have a habitat.
+type Location struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Generations []uint   `json:"generations,omitempty"`
+	Habitats    []string `json:"habitats,omitempty"`
+}
+
+var Locations = []Location{
+	{ID: "kanto", Name: "Kanto", Generations: []uint{1}},
+	{ID: "johto", Name: "Johto", Generations: []uint{2}},
+	{ID: "hoenn", Name: "Hoenn", Generations: []uint{3}},
+	{ID: "sinnoh", Name: "Sinnoh", Generations: []uint{4}},
+	{ID: "unova", Name: "Unova", Generations: []uint{5}},
+	{ID: "kalos", Name: "Kalos", Generations: []uint{6}},
+	{ID: "alola", Name: "Alola", Generations: []uint{7}},
+	{ID: "galar", Name: "Galar", Generations: []uint{8}},
+	{ID: "cave", Name: "Cave", Habitats: []string{"cave"}},
+	{ID: "forest", Name: "Forest", Habitats: []string{"forest"}},
+	{ID: "grassland", Name: "Grassland", Habitats: []string{"grassland"}},
+	{ID: "mountain", Name: "Mountain", Habitats: []string{"mountain"}},
+	{ID: "rough-terrain", Name: "Rough Terrain", Habitats: []string{"rough-terrain"}},
+	{ID: "sea", Name: "Sea", Habitats: []string{"sea", "waters-edge"}},
+	{ID: "urban", Name: "City", Habitats: []string{"urban"}},
+}
+
+func FindLocation(id string) (Location, bool) {
+	for _, location := range Locations {
+		if location.ID == id {
+			return location, true
+		}
+	}
+	return Location{}, false
+}
+
+func (l Location) Contains(p models.Pokemon) bool {
+	for _, generation := range l.Generations {
+		if p.Generation == generation {
+			return true
+		}
+	}
+	for _, habitat := range l.Habitats {
+		if p.Habitat == habitat {
+			return true
+		}
+	}
+	return false
+}
+
+func LocationModifier(l Location) Modifier {
+	return func(p models.Pokemon) float64 {
+		if l.Contains(p) {
+			return LocationBoost
+		}
+		return 1
+	}
+}
@@ -0,0 +1,51 @@
+package encounter_test
+
+import (
+	"math"
+	"testing"
+
+	"susie.mx/gokemon/encounter"
+	"susie.mx/gokemon/models"
+)
+
+func TestLocationModifier(t *testing.T) {
+	pokemon := testPokemon()
+	for i := range pokemon {
+		pokemon[i].Generation = 1
+		if pokemon[i].ID > 151 {
+			pokemon[i].Generation = 2
+		}
+	}
+	table, err := encounter.NewTable(pokemon, encounter.DefaultConfig)
+	if err != nil {
+		t.Fatalf("failed to create table: %s", err)
+	}
+	kanto, ok := encounter.FindLocation("kanto")
+	if !ok {
+		t.Fatalf("kanto is not a location")
+	}
+	counts := draw(t, table, encounter.LocationModifier(kanto))
+	inKanto := 0
+	for id := uint(1); id <= 151; id++ {
+		inKanto += counts[id]
+	}
+	// Mewtwo and Mew have lower weights, which is negligible here
+	kantoWeight := 151 * 100.0 * encounter.LocationBoost
+	expected := kantoWeight / (kantoWeight + 747*100) * numDraws
+	if math.Abs(float64(inKanto)-expected) > 0.02*numDraws {
+		t.Fatalf("pokemon from the location drawn %d times, expected about %.0f", inKanto, expected)
+	}
+}
+
+func TestLocationContainsHabitat(t *testing.T) {
+	sea, ok := encounter.FindLocation("sea")
+	if !ok {
+		t.Fatalf("sea is not a location")
+	}
+	if !sea.Contains(models.Pokemon{Habitat: "waters-edge"}) {
+		t.Fatalf("expected sea to contain waters-edge pokemon")
+	}
+	if sea.Contains(models.Pokemon{Habitat: "cave"}) {
+		t.Fatalf("expected sea not to contain cave pokemon")
+	}
+}
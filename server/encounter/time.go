@@ -0,0 +1,104 @@
+package encounter
+
+import (
+	"time"
+
+	"susie.mx/gokemon/models"
+)
+
+// A TimeRule boosts pokemon during certain hours or on certain days of the
+// week in the user's local time
+type TimeRule struct {
+	Name string `json:"name"`
+	// The rule applies from FromHour until ToHour, wrapping past midnight when
+	// FromHour is after ToHour. Equal hours apply all day.
+	FromHour int `json:"fromHour"`
+	ToHour   int `json:"toHour"`
+	// No weekdays applies every day
+	Weekdays   []time.Weekday `json:"weekdays,omitempty"`
+	PokemonIDs []uint         `json:"pokemonIds,omitempty"`
+	Types      []string       `json:"types,omitempty"`
+	Multiplier float64        `json:"multiplier"`
+}
+
+var TimeRules = []TimeRule{
+	{
+		Name:       "Night",
+		FromHour:   20,
+		ToHour:     6,
+		Types:      []string{"ghost", "dark"},
+		Multiplier: 3,
+	},
+	{
+		Name:       "Lapras Friday",
+		Weekdays:   []time.Weekday{time.Friday},
+		PokemonIDs: []uint{131},
+		Multiplier: 20,
+	},
+}
+
+func (r TimeRule) ActiveAt(t time.Time) bool {
+	if len(r.Weekdays) > 0 {
+		onWeekday := false
+		for _, weekday := range r.Weekdays {
+			onWeekday = onWeekday || t.Weekday() == weekday
+		}
+		if !onWeekday {
+			return false
+		}
+	}
+	hour := t.Hour()
+	switch {
+	case r.FromHour == r.ToHour:
+		return true
+	case r.FromHour < r.ToHour:
+		return hour >= r.FromHour && hour < r.ToHour
+	default:
+		return hour >= r.FromHour || hour < r.ToHour
+	}
+}
+
+func (r TimeRule) Matches(p models.Pokemon) bool {
+	for _, id := range r.PokemonIDs {
+		if p.ID == id {
+			return true
+		}
+	}
+	for _, t := range r.Types {
+		if HasType(p, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// TimeModifiers returns a modifier for every rule active at t, which should be
+// in the user's time zone
+func TimeModifiers(t time.Time) []Modifier {
+	modifiers := []Modifier{}
+	for _, rule := range TimeRules {
+		if !rule.ActiveAt(t) {
+			continue
+		}
+		rule := rule
+		modifiers = append(modifiers, func(p models.Pokemon) float64 {
+			if rule.Matches(p) {
+				return rule.Multiplier
+			}
+			return 1
+		})
+	}
+	return modifiers
+}
+
+// HasType reports whether any of the pokemon's forms has the type
+func HasType(p models.Pokemon, typeName string) bool {
+	for _, form := range p.Forms {
+		for _, t := range form.Types {
+			if t.Name == typeName {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package encounter_test
+
+import (
+	"testing"
+	"time"
+
+	"susie.mx/gokemon/encounter"
+)
+
+func TestTimeRuleActiveAt(t *testing.T) {
+	night := encounter.TimeRule{FromHour: 20, ToHour: 6}
+	friday := encounter.TimeRule{Weekdays: []time.Weekday{time.Friday}}
+	fridayMorning := encounter.TimeRule{FromHour: 6, ToHour: 12, Weekdays: []time.Weekday{time.Friday}}
+	tests := []struct {
+		rule   encounter.TimeRule
+		at     time.Time
+		active bool
+	}{
+		{night, time.Date(2022, 6, 1, 23, 0, 0, 0, time.UTC), true},
+		{night, time.Date(2022, 6, 1, 3, 0, 0, 0, time.UTC), true},
+		{night, time.Date(2022, 6, 1, 6, 0, 0, 0, time.UTC), false},
+		{night, time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC), false},
+		{friday, time.Date(2022, 6, 3, 0, 0, 0, 0, time.UTC), true},
+		{friday, time.Date(2022, 6, 4, 0, 0, 0, 0, time.UTC), false},
+		{fridayMorning, time.Date(2022, 6, 3, 8, 0, 0, 0, time.UTC), true},
+		{fridayMorning, time.Date(2022, 6, 3, 13, 0, 0, 0, time.UTC), false},
+		{fridayMorning, time.Date(2022, 6, 2, 8, 0, 0, 0, time.UTC), false},
+	}
+	for _, test := range tests {
+		if active := test.rule.ActiveAt(test.at); active != test.active {
+			t.Fatalf("rule %+v at %s: expected active %t", test.rule, test.at, test.active)
+		}
+	}
+}
+
+func TestTimeModifiersUseLocalTime(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %s", err)
+	}
+	// Thursday afternoon in UTC is already Friday night in Tokyo
+	at := time.Date(2022, 6, 2, 16, 0, 0, 0, time.UTC)
+	if n := len(encounter.TimeModifiers(at)); n != 0 {
+		t.Fatalf("expected no rules on a Thursday afternoon, got %d", n)
+	}
+	if n := len(encounter.TimeModifiers(at.In(tokyo))); n != 2 {
+		t.Fatalf("expected night and friday rules in Tokyo, got %d", n)
+	}
+}
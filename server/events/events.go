@@ -0,0 +1,87 @@
+package events
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"susie.mx/gokemon/encounter"
+	"susie.mx/gokemon/models"
+)
+
+// Active returns the events running at now
+func Active(db *gorm.DB, now time.Time) ([]models.Event, error) {
+	events := []models.Event{}
+	err := db.Preload("BoostedPokemon").
+		Where("starts_at <= ? AND ends_at > ?", now.UnixMilli(), now.UnixMilli()).
+		Order("starts_at").
+		Find(&events).Error
+	return events, err
+}
+
+// Upcoming returns the events that have not ended yet, including active ones
+func Upcoming(db *gorm.DB, now time.Time) ([]models.Event, error) {
+	events := []models.Event{}
+	err := db.Preload("BoostedPokemon").
+		Where("ends_at > ?", now.UnixMilli()).
+		Order("starts_at").
+		Find(&events).Error
+	return events, err
+}
+
+func IsBoosted(event models.Event, p models.Pokemon) bool {
+	for _, boosted := range event.BoostedPokemon {
+		if boosted.ID == p.ID {
+			return true
+		}
+	}
+	return event.BoostedType != "" && encounter.HasType(p, event.BoostedType)
+}
+
+// Modifiers returns an encounter modifier for every event that boosts spawns
+func Modifiers(events []models.Event) []encounter.Modifier {
+	modifiers := []encounter.Modifier{}
+	for _, event := range events {
+		if event.SpawnMultiplier <= 0 || event.SpawnMultiplier == 1 {
+			continue
+		}
+		event := event
+		modifiers = append(modifiers, func(p models.Pokemon) float64 {
+			if IsBoosted(event, p) {
+				return event.SpawnMultiplier
+			}
+			return 1
+		})
+	}
+	return modifiers
+}
+
+// ShinyRate applies the shiny multipliers of overlapping events on top of each
+// other
+func ShinyRate(baseRate float64, events []models.Event) float64 {
+	rate := baseRate
+	for _, event := range events {
+		if event.ShinyMultiplier > 0 {
+			rate *= event.ShinyMultiplier
+		}
+	}
+	if rate > 1 {
+		return 1
+	}
+	return rate
+}
+
+// NewPokemonInterval returns the shortest interval of any event, falling back
+// to baseInterval when no event overrides it
+func NewPokemonInterval(baseInterval time.Duration, events []models.Event) time.Duration {
+	interval := baseInterval
+	for _, event := range events {
+		if event.NewPokemonIntervalMinutes == 0 {
+			continue
+		}
+		eventInterval := time.Duration(event.NewPokemonIntervalMinutes) * time.Minute
+		if eventInterval < interval {
+			interval = eventInterval
+		}
+	}
+	return interval
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/sessions"
@@ -20,7 +26,9 @@ import (
 
 	"susie.mx/gokemon/discord"
 	"susie.mx/gokemon/discordbot"
+	"susie.mx/gokemon/encounter"
 	"susie.mx/gokemon/models"
+	"susie.mx/gokemon/scheduler"
 	"susie.mx/gokemon/server"
 )
 
@@ -40,11 +48,24 @@ func main() {
 	discordRedirectUri := os.Getenv("DISCORD_REDIRECT_URI")
 	discordBotAuthToken := os.Getenv("DISCORD_BOT_AUTH_TOKEN")
 	discordBotGuilds := strings.Split(os.Getenv("DISCORD_BOT_GUILDS"), ",")
+	discordBotAnnouncementChannel := os.Getenv("DISCORD_BOT_ANNOUNCEMENT_CHANNEL")
 
 	sessionStoreAuthKey := os.Getenv("SESSION_STORE_AUTH_KEY")
 
 	clientBaseURL := os.Getenv("CLIENT_BASE_URL")
 
+	encounterConfigPath := os.Getenv("ENCOUNTER_CONFIG_PATH")
+
+	tradeRequestExpiry := server.DefaultTradeRequestExpiry
+	if hours, err := strconv.Atoi(os.Getenv("TRADE_REQUEST_EXPIRY_HOURS")); err == nil && hours > 0 {
+		tradeRequestExpiry = time.Duration(hours) * time.Hour
+	}
+
+	shinyPityBatches := uint(server.DefaultShinyPityBatches)
+	if batches, err := strconv.Atoi(os.Getenv("SHINY_PITY_BATCHES")); err == nil && batches >= 0 {
+		shinyPityBatches = uint(batches)
+	}
+
 	dsn := fmt.Sprintf("host=localhost user=%s password=%s dbname=gokemon", pgUsername, pgPassword)
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
@@ -58,8 +79,9 @@ func main() {
 		RedirectURI:  discordRedirectUri,
 	}
 
-	discordBot := discordbot.New(discordBotAuthToken, discordBotGuilds, db)
+	discordBot := discordbot.New(discordBotAuthToken, discordBotGuilds, discordBotAnnouncementChannel, db)
 	go discordBot.Start()
+	defer discordBot.Stop()
 
 	if err := db.AutoMigrate(&models.OwnedPokemon{}); err != nil {
 		log.Fatalln(err)
@@ -70,18 +92,119 @@ func main() {
 	if err := db.AutoMigrate(&models.Pokemon{}); err != nil {
 		log.Fatalln(err)
 	}
+	if err := db.AutoMigrate(&models.PokemonForm{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.PokemonAbility{}); err != nil {
+		log.Fatalln(err)
+	}
 	if err := db.AutoMigrate(&models.FriendRequest{}); err != nil {
 		log.Fatalln(err)
 	}
 	if err := db.AutoMigrate(&models.TradeRequest{}); err != nil {
 		log.Fatalln(err)
 	}
+	if err := db.AutoMigrate(&models.Job{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.Trade{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.OwnershipRecord{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.TradeListing{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.WonderTradeDeposit{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.Notification{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.WishlistEntry{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.PokedexEntry{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.UserAchievement{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.Event{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.EncounterStats{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.Evolution{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.EvolutionRecord{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.WalletBalance{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.WalletTransaction{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.Battle{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.BattleMember{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.BattleAction{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.Team{}); err != nil {
+		log.Fatalln(err)
+	}
+	if err := db.AutoMigrate(&models.TeamMember{}); err != nil {
+		log.Fatalln(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	jobScheduler := scheduler.New(db)
 
 	s := &server.Server{
 		DB:            db,
 		DiscordClient: &discordClient,
 		ClientBaseURL: clientBaseURL,
+		Scheduler:     jobScheduler,
+		Encounters:    &encounter.Store{},
+
+		EncounterConfigPath: encounterConfigPath,
+		TradeRequestExpiry:  tradeRequestExpiry,
+		ShinyPityBatches:    shinyPityBatches,
+	}
+
+	// Without any pokemon the server still runs, but nothing can be encountered
+	// until the scraper has been run and the table reloaded
+	if err := s.ReloadEncounterTable(); errors.Is(err, encounter.ErrEmptyTable) {
+		log.Printf("loading encounter table failed: %s", err)
+	} else if err != nil {
+		log.Fatalf("loading encounter table failed: %s", err)
 	}
+	// Send SIGHUP to pick up changes to the encounter config without a restart
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := s.ReloadEncounterTable(); err != nil {
+				log.Printf("reloading encounter table failed: %s", err)
+				continue
+			}
+			log.Println("Reloaded encounter table")
+		}
+	}()
+
+	jobScheduler.Handle(server.DeliverPendingPokemonJob, s.DeliverPendingPokemon)
+	jobScheduler.Handle(server.ExpireTradeRequestJob, s.ExpireTradeRequest)
+	jobScheduler.Handle(server.AnnounceEventJob, discordBot.AnnounceEvent)
 
 	store := cookie.NewStore([]byte(sessionStoreAuthKey))
 	store.Options(sessions.Options{Path: "/", MaxAge: 60 * 60 * 24})
@@ -102,18 +225,34 @@ func main() {
 	}))
 	r.GET("/api/v1/pokemon", s.GetPokemons)
 	r.POST("/api/v1/pendingPokemon/select", s.SelectPokemon)
+	r.POST("/api/v1/pendingPokemon/reroll", s.RerollPendingPokemon)
+	r.POST("/api/v1/pendingPokemon/skip", s.SkipPendingPokemon)
+	r.POST("/api/v1/pendingPokemon/hold", s.HoldPendingPokemon)
+	r.DELETE("/api/v1/pendingPokemon/hold", s.DeleteHeldPokemon)
 
 	r.GET("/api/v1/auth/discord/redirect", s.DiscordLogin)
 	r.GET("/api/v1/auth/logout", s.Logout)
 
 	r.GET("/api/v1/user/", s.GetUser)
 	r.GET("/api/v1/user/:username", s.GetUser)
+	r.GET("/api/v1/user/:username/pokedex", s.GetPokedex)
 	r.PUT("/api/v1/user/preferredForm", s.UpdatePreferredForm)
+	r.PUT("/api/v1/user/location", s.UpdateLocation)
+	r.PUT("/api/v1/user/timezone", s.UpdateTimezone)
+	r.GET("/api/v1/locations", s.GetLocations)
 
 	r.POST("api/v1/friendships", s.PostFriendship)
 	r.DELETE("api/v1/friendships", s.DeleteFriendship)
 
 	r.POST("api/v1/acceptTrade", s.AcceptTrade)
+	r.GET("/api/v1/tradeHistory", s.GetTradeHistory)
+	r.GET("/api/v1/ownedPokemon/:id/history", s.GetOwnedPokemonHistory)
+	r.POST("/api/v1/ownedPokemon/:id/evolve", s.EvolvePokemon)
+	r.POST("/api/v1/ownedPokemon/:id/release", s.ReleasePokemon)
+	r.POST("/api/v1/ownedPokemon/:id/levelUp", s.LevelUpPokemon)
+	r.PUT("/api/v1/ownedPokemon/:id", s.UpdateOwnedPokemon)
+	r.GET("/api/v1/ownedPokemon/notes", s.GetOwnedPokemonNotes)
+	r.GET("/api/v1/wallet/transactions", s.GetWalletTransactions)
 
 	r.GET("/api/v1/friendRequests", s.GetFriendRequests)
 	r.POST("/api/v1/friendRequests", s.PostFriendRequest)
@@ -122,11 +261,72 @@ func main() {
 	r.GET("/api/v1/tradeRequests", s.GetTradeRequests)
 	r.POST("/api/v1/tradeRequests", s.PostTradeRequest)
 	r.DELETE("/api/v1/tradeRequests", s.DeleteTradeRequest)
+	r.POST("/api/v1/tradeRequests/counter", s.CounterTradeRequest)
+
+	r.GET("/api/v1/teams", s.GetTeams)
+	r.POST("/api/v1/teams", s.PostTeam)
+	r.PUT("/api/v1/teams", s.UpdateTeam)
+	r.DELETE("/api/v1/teams", s.DeleteTeam)
+
+	r.GET("/api/v1/battles", s.GetBattles)
+	r.POST("/api/v1/battles", s.PostBattle)
+	r.DELETE("/api/v1/battles", s.DeleteBattle)
+	r.POST("/api/v1/battles/accept", s.AcceptBattle)
+	r.POST("/api/v1/battles/move", s.BattleMove)
+	r.GET("/api/v1/battles/:id/replay", s.GetBattleReplay)
+
+	r.GET("/api/v1/gts", s.GetTradeListings)
+	r.POST("/api/v1/gts", s.PostTradeListing)
+	r.DELETE("/api/v1/gts", s.DeleteTradeListing)
+	r.POST("/api/v1/gts/offer", s.OfferTradeListing)
+
+	r.GET("/api/v1/wonderTrade", s.GetWonderTradeDeposits)
+	r.POST("/api/v1/wonderTrade", s.PostWonderTrade)
+	r.DELETE("/api/v1/wonderTrade", s.DeleteWonderTrade)
 
+	r.GET("/api/v1/wishlist", s.GetWishlist)
+	r.POST("/api/v1/wishlist", s.PostWishlistEntry)
+	r.DELETE("/api/v1/wishlist", s.DeleteWishlistEntry)
+	r.GET("/api/v1/tradeSuggestions", s.GetTradeSuggestions)
+
+	r.GET("/api/v1/achievements", s.GetAchievements)
+
+	r.GET("/api/v1/events", s.GetEvents)
+	r.POST("/api/v1/events", s.PostEvent)
+	r.DELETE("/api/v1/events", s.DeleteEvent)
+
+	r.GET("/api/v1/notifications", s.GetNotifications)
+	r.POST("/api/v1/notifications/read", s.ReadNotifications)
+
+	// Users waiting on pending pokemon must always have a delivery job, including
+	// ones created before the scheduler existed
 	var users []models.User
-	s.DB.Find(&users)
+	s.DB.Where("NOT EXISTS (SELECT 1 FROM owned_pokemons WHERE pending_owner_id = users.id)").Find(&users)
 	for _, user := range users {
-		go s.NewPokemonTimer(user.ID)
+		if err := s.ScheduleNewPokemon(s.DB, user); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	schedulerDone := make(chan struct{})
+	go func() {
+		jobScheduler.Run(ctx)
+		close(schedulerDone)
+	}()
+
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("serving http failed: %s", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutting down http server failed: %s", err)
 	}
-	r.Run(":8080")
+	<-schedulerDone
 }
@@ -0,0 +1,8 @@
+package models
+
+type UserAchievement struct {
+	ID            uint   `json:"id" gorm:"primary_key"`
+	UserID        uint   `json:"userId" gorm:"uniqueIndex:idx_user_achievements_user_achievement"`
+	AchievementID string `json:"achievementId" gorm:"uniqueIndex:idx_user_achievements_user_achievement"`
+	AwardedAt     int64  `json:"awardedAt"`
+}
@@ -0,0 +1,60 @@
+package models
+
+const (
+	BattleChallenged = "challenged"
+	BattleActive     = "active"
+	BattleFinished   = "finished"
+	BattleDeclined   = "declined"
+)
+
+// Battle is a battle between a user and a friend they challenged. The
+// challenger is side 0 and the friend side 1. Its state is not stored, it is
+// rebuilt by replaying the actions on the members with the seed.
+type Battle struct {
+	ID       uint   `json:"id" gorm:"primary_key"`
+	Status   string `json:"status" gorm:"default:challenged;index"`
+	UserID   uint   `json:"userId" gorm:"index"`
+	User     User   `json:"user"`
+	FriendID uint   `json:"friendId" gorm:"index"`
+	Friend   User   `json:"friend"`
+	Seed     int64  `json:"-"`
+	// Number of turns resolved so far
+	Turn       uint           `json:"turn"`
+	WinnerID   *uint          `json:"winnerId"`
+	Forfeited  bool           `json:"forfeited"`
+	Members    []BattleMember `json:"members"`
+	Actions    []BattleAction `json:"-"`
+	CreatedAt  int64          `json:"createdAt" gorm:"autoCreateTime:milli"`
+	AcceptedAt int64          `json:"acceptedAt"`
+	FinishedAt int64          `json:"finishedAt"`
+}
+
+// BattleMember is a snapshot of a pokemon as it was when its team entered the
+// battle, so that leveling or trading it later does not change the battle
+type BattleMember struct {
+	ID             uint    `json:"id" gorm:"primary_key"`
+	BattleID       uint    `json:"battleId" gorm:"index"`
+	Side           uint    `json:"side"`
+	Position       uint    `json:"position"`
+	OwnedPokemonID uint    `json:"ownedPokemonId"`
+	PokemonID      uint    `json:"pokemonId"`
+	Pokemon        Pokemon `json:"pokemon"`
+	FormIndex      uint    `json:"formIndex"`
+	Level          uint    `json:"level"`
+	Nature         string  `json:"nature"`
+	IVs            Stats   `json:"ivs" gorm:"embedded;embeddedPrefix:iv_"`
+	Nickname       string  `json:"nickname"`
+	IsShiny        bool    `json:"isShiny"`
+	Gender         uint    `json:"gender"`
+}
+
+// BattleAction is what a side chose to do in a turn
+type BattleAction struct {
+	ID        uint   `json:"id" gorm:"primary_key"`
+	BattleID  uint   `json:"battleId" gorm:"uniqueIndex:idx_battle_actions_turn_side"`
+	Turn      uint   `json:"turn" gorm:"uniqueIndex:idx_battle_actions_turn_side"`
+	Side      uint   `json:"side" gorm:"uniqueIndex:idx_battle_actions_turn_side"`
+	Kind      string `json:"kind"`
+	Index     int    `json:"index"`
+	CreatedAt int64  `json:"createdAt" gorm:"autoCreateTime:milli"`
+}
@@ -0,0 +1,17 @@
+package models
+
+type EncounterStats struct {
+	ID                   uint `json:"-" gorm:"primary_key"`
+	UserID               uint `json:"userId" gorm:"uniqueIndex"`
+	TotalEncounters      uint `json:"totalEncounters"`
+	ShinyEncounters      uint `json:"shinyEncounters"`
+	EncountersSinceShiny uint `json:"encountersSinceShiny"`
+	// Batches of pending pokemon delivered since one contained a shiny, used
+	// for the shiny pity
+	BatchesSinceShiny uint `json:"batchesSinceShiny"`
+	// The species selected in a row most recently, and how many times
+	ChainPokemonID        *uint `json:"chainPokemonId"`
+	ChainLength           uint  `json:"chainLength"`
+	LongestChainPokemonID *uint `json:"longestChainPokemonId"`
+	LongestChainLength    uint  `json:"longestChainLength"`
+}
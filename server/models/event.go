@@ -0,0 +1,20 @@
+package models
+
+type Event struct {
+	ID          uint   `json:"id" gorm:"primary_key"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	StartsAt    int64  `json:"startsAt" gorm:"index"`
+	EndsAt      int64  `json:"endsAt" gorm:"index"`
+	// Species that are boosted, in addition to every species of BoostedType
+	BoostedPokemon  []Pokemon `json:"boostedPokemon" gorm:"many2many:event_boosted_pokemon"`
+	BoostedType     string    `json:"boostedType"`
+	SpawnMultiplier float64   `json:"spawnMultiplier"`
+	ShinyMultiplier float64   `json:"shinyMultiplier"`
+	// Overrides the time between pending pokemon batches when non-zero
+	NewPokemonIntervalMinutes uint  `json:"newPokemonIntervalMinutes"`
+	CreatedByID               uint  `json:"createdById"`
+	CreatedAt                 int64 `json:"createdAt" gorm:"autoCreateTime:milli"`
+	// Set once the event has been posted to the announcement channel
+	AnnouncedAt int64 `json:"announcedAt"`
+}
@@ -0,0 +1,38 @@
+package models
+
+const (
+	EvolutionTriggerLevelUp = "level-up"
+	EvolutionTriggerTrade   = "trade"
+	EvolutionTriggerUseItem = "use-item"
+)
+
+// An Evolution is one way for a species to evolve into another. A species may
+// have several ways to evolve into the same species, any of which is enough.
+type Evolution struct {
+	ID            uint    `json:"id" gorm:"primary_key"`
+	FromPokemonID uint    `json:"fromPokemonId" gorm:"index"`
+	ToPokemonID   uint    `json:"toPokemonId"`
+	ToPokemon     Pokemon `json:"toPokemon"`
+	Trigger       string  `json:"trigger"`
+	MinLevel      *uint   `json:"minLevel"`
+	Item          string  `json:"item"`
+	HeldItem      string  `json:"heldItem"`
+	MinHappiness  *uint   `json:"minHappiness"`
+	// For trades, the species the pokemon must be traded for
+	TradeSpeciesID *uint  `json:"tradeSpeciesId"`
+	TimeOfDay      string `json:"timeOfDay"`
+	Gender         *uint  `json:"gender"`
+	// Requirements the game has no way of checking, e.g. knowing a move or
+	// being at a location
+	HasOtherRequirements bool `json:"hasOtherRequirements"`
+}
+
+type EvolutionRecord struct {
+	ID             uint  `json:"id" gorm:"primary_key"`
+	OwnedPokemonID uint  `json:"ownedPokemonId" gorm:"index"`
+	FromPokemonID  uint  `json:"fromPokemonId"`
+	FromFormIndex  uint  `json:"fromFormIndex"`
+	ToPokemonID    uint  `json:"toPokemonId"`
+	ToFormIndex    uint  `json:"toFormIndex"`
+	EvolvedAt      int64 `json:"evolvedAt"`
+}
@@ -0,0 +1,10 @@
+package models
+
+type Job struct {
+	ID        uint   `json:"id" gorm:"primary_key"`
+	Kind      string `json:"kind" gorm:"uniqueIndex:idx_jobs_kind_subject"`
+	SubjectID uint   `json:"subjectId" gorm:"uniqueIndex:idx_jobs_kind_subject"`
+	RunAt     int64  `json:"runAt" gorm:"index"`
+	Attempts  uint   `json:"attempts"`
+	LastError string `json:"lastError"`
+}
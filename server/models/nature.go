@@ -0,0 +1,46 @@
+package models
+
+// A Nature raises one stat by 10% and lowers another by 10%. Natures that
+// would raise and lower the same stat have no effect.
+type Nature struct {
+	Name      string `json:"name"`
+	Increased string `json:"increased"`
+	Decreased string `json:"decreased"`
+}
+
+var Natures = []Nature{
+	{"hardy", StatAttack, StatAttack},
+	{"lonely", StatAttack, StatDefense},
+	{"brave", StatAttack, StatSpeed},
+	{"adamant", StatAttack, StatSpecialAttack},
+	{"naughty", StatAttack, StatSpecialDefense},
+	{"bold", StatDefense, StatAttack},
+	{"docile", StatDefense, StatDefense},
+	{"relaxed", StatDefense, StatSpeed},
+	{"impish", StatDefense, StatSpecialAttack},
+	{"lax", StatDefense, StatSpecialDefense},
+	{"timid", StatSpeed, StatAttack},
+	{"hasty", StatSpeed, StatDefense},
+	{"serious", StatSpeed, StatSpeed},
+	{"jolly", StatSpeed, StatSpecialAttack},
+	{"naive", StatSpeed, StatSpecialDefense},
+	{"modest", StatSpecialAttack, StatAttack},
+	{"mild", StatSpecialAttack, StatDefense},
+	{"quiet", StatSpecialAttack, StatSpeed},
+	{"bashful", StatSpecialAttack, StatSpecialAttack},
+	{"rash", StatSpecialAttack, StatSpecialDefense},
+	{"calm", StatSpecialDefense, StatAttack},
+	{"gentle", StatSpecialDefense, StatDefense},
+	{"sassy", StatSpecialDefense, StatSpeed},
+	{"careful", StatSpecialDefense, StatSpecialAttack},
+	{"quirky", StatSpecialDefense, StatSpecialDefense},
+}
+
+func FindNature(name string) (Nature, bool) {
+	for _, nature := range Natures {
+		if nature.Name == name {
+			return nature, true
+		}
+	}
+	return Nature{}, false
+}
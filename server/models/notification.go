@@ -0,0 +1,9 @@
+package models
+
+type Notification struct {
+	ID        uint   `json:"id" gorm:"primary_key"`
+	UserID    uint   `json:"userId" gorm:"index"`
+	Message   string `json:"message"`
+	IsRead    bool   `json:"isRead"`
+	CreatedAt int64  `json:"createdAt" gorm:"autoCreateTime:milli"`
+}
@@ -0,0 +1,12 @@
+package models
+
+type PokedexEntry struct {
+	ID            uint  `json:"id" gorm:"primary_key"`
+	UserID        uint  `json:"userId" gorm:"uniqueIndex:idx_pokedex_entries_user_variant"`
+	PokemonID     uint  `json:"pokemonId" gorm:"uniqueIndex:idx_pokedex_entries_user_variant"`
+	FormIndex     uint  `json:"formIndex" gorm:"uniqueIndex:idx_pokedex_entries_user_variant"`
+	IsShiny       bool  `json:"isShiny" gorm:"uniqueIndex:idx_pokedex_entries_user_variant"`
+	IsCaught      bool  `json:"isCaught"`
+	FirstSeenAt   int64 `json:"firstSeenAt"`
+	FirstCaughtAt int64 `json:"firstCaughtAt"`
+}
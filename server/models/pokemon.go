@@ -3,20 +3,55 @@ package models
 const MaxPokemonId = 898
 
 type Pokemon struct {
-	ID                   uint          `json:"id" gorm:"primary_key"`
-	Name                 string        `json:"name"`
-	HasGenderDifferences bool          `json:"hasGenderDifferences"`
-	IsLegendary          bool          `json:"isLegendary"`
-	IsMythical           bool          `json:"isMythical"`
-	Forms                []PokemonForm `json:"forms"`
+	ID                   uint   `json:"id" gorm:"primary_key"`
+	Name                 string `json:"name"`
+	HasGenderDifferences bool   `json:"hasGenderDifferences"`
+	IsLegendary          bool   `json:"isLegendary"`
+	IsMythical           bool   `json:"isMythical"`
+	Generation           uint   `json:"generation"`
+	Habitat              string `json:"habitat"`
+	// Chance of being female in eighths, or -1 for genderless species. It is
+	// nil for pokemon scraped before gender rates were, until they are
+	// scraped again.
+	GenderRate *int          `json:"genderRate"`
+	Forms      []PokemonForm `json:"forms"`
 }
 
 type PokemonForm struct {
-	ID        uint    `json:"id" gorm:"primary_key"`
-	PokemonID uint    `json:"pokemonId"`
-	Name      string  `json:"name"`
-	Types     []Type  `json:"types" gorm:"many2many:pokemon_types"`
-	Sprites   Sprites `json:"sprites"`
+	ID        uint             `json:"id" gorm:"primary_key"`
+	PokemonID uint             `json:"pokemonId"`
+	Name      string           `json:"name"`
+	Types     []Type           `json:"types" gorm:"many2many:pokemon_types"`
+	Sprites   Sprites          `json:"sprites"`
+	BaseStats Stats            `json:"baseStats" gorm:"embedded;embeddedPrefix:base_"`
+	Abilities []PokemonAbility `json:"abilities"`
+}
+
+// Stat names as PokeAPI spells them
+const (
+	StatHP             = "hp"
+	StatAttack         = "attack"
+	StatDefense        = "defense"
+	StatSpecialAttack  = "special-attack"
+	StatSpecialDefense = "special-defense"
+	StatSpeed          = "speed"
+)
+
+type Stats struct {
+	HP             uint `json:"hp"`
+	Attack         uint `json:"attack"`
+	Defense        uint `json:"defense"`
+	SpecialAttack  uint `json:"specialAttack"`
+	SpecialDefense uint `json:"specialDefense"`
+	Speed          uint `json:"speed"`
+}
+
+type PokemonAbility struct {
+	ID            uint   `json:"-" gorm:"primary_key"`
+	PokemonFormID uint   `json:"pokemonFormId" gorm:"index"`
+	Name          string `json:"name"`
+	IsHidden      bool   `json:"isHidden"`
+	Slot          uint   `json:"slot"`
 }
 
 type Sprites struct {
@@ -0,0 +1,23 @@
+package models
+
+// Team is a named party a user saved. At most one of a user's teams is
+// active.
+type Team struct {
+	ID        uint         `json:"id" gorm:"primary_key"`
+	UserID    uint         `json:"userId" gorm:"index"`
+	Name      string       `json:"name"`
+	IsActive  bool         `json:"isActive"`
+	Members   []TeamMember `json:"members"`
+	CreatedAt int64        `json:"createdAt" gorm:"autoCreateTime:milli"`
+	UpdatedAt int64        `json:"updatedAt" gorm:"autoUpdateTime:milli"`
+}
+
+// TeamMember is a pokemon in a team. Members are ordered by Position, which
+// can have gaps after a member was traded away or released.
+type TeamMember struct {
+	ID             uint         `json:"id" gorm:"primary_key"`
+	TeamID         uint         `json:"teamId" gorm:"index"`
+	Position       uint         `json:"position"`
+	OwnedPokemonID uint         `json:"ownedPokemonId" gorm:"index"`
+	OwnedPokemon   OwnedPokemon `json:"ownedPokemon"`
+}
@@ -0,0 +1,69 @@
+package models
+
+// Trade is an append-only record of a completed trade
+type Trade struct {
+	ID             uint           `json:"id" gorm:"primary_key"`
+	TradeRequestID *uint          `json:"tradeRequestId"`
+	TradeListingID *uint          `json:"tradeListingId"`
+	IsWonderTrade  bool           `json:"isWonderTrade"`
+	UserID         uint           `json:"userId" gorm:"index"`
+	User           User           `json:"user"`
+	UserPokemon    []OwnedPokemon `json:"userPokemon" gorm:"many2many:trade_user_pokemon"`
+	FriendID       uint           `json:"friendId" gorm:"index"`
+	Friend         User           `json:"friend"`
+	FriendPokemon  []OwnedPokemon `json:"friendPokemon" gorm:"many2many:trade_friend_pokemon"`
+	RequestedAt    int64          `json:"requestedAt"`
+	CompletedAt    int64          `json:"completedAt"`
+}
+
+const (
+	AcquiredByCatching = "caught"
+	AcquiredByTrade    = "trade"
+)
+
+// OwnershipRecord is an append-only record of an owned pokemon changing hands
+type OwnershipRecord struct {
+	ID             uint   `json:"id" gorm:"primary_key"`
+	OwnedPokemonID uint   `json:"ownedPokemonId" gorm:"index"`
+	OwnerID        uint   `json:"ownerId"`
+	Owner          User   `json:"owner"`
+	Method         string `json:"method"`
+	TradeID        *uint  `json:"tradeId"`
+	AcquiredAt     int64  `json:"acquiredAt"`
+}
+
+const (
+	TradeListingOpen        = "open"
+	TradeListingCompleted   = "completed"
+	TradeListingWithdrawn   = "withdrawn"
+	TradeListingInvalidated = "invalidated"
+)
+
+// TradeListing is a pokemon put up on the Global Trade Station, which anyone
+// can trade for by offering a pokemon that matches the wanted criteria
+type TradeListing struct {
+	ID                uint         `json:"id" gorm:"primary_key"`
+	Status            string       `json:"status" gorm:"default:open;index"`
+	UserID            uint         `json:"userId" gorm:"index"`
+	User              User         `json:"user"`
+	OwnedPokemonID    uint         `json:"ownedPokemonId" gorm:"index"`
+	OwnedPokemon      OwnedPokemon `json:"ownedPokemon"`
+	WantedPokemonID   *uint        `json:"wantedPokemonId" gorm:"index"`
+	WantedPokemon     *Pokemon     `json:"wantedPokemon,omitempty"`
+	WantedFormIndex   *uint        `json:"wantedFormIndex"`
+	WantedIsShiny     *bool        `json:"wantedIsShiny"`
+	WantedIsLegendary *bool        `json:"wantedIsLegendary"`
+	TradeID           *uint        `json:"tradeId"`
+	CreatedAt         int64        `json:"createdAt" gorm:"autoCreateTime:milli"`
+	ClosedAt          int64        `json:"closedAt"`
+}
+
+// WonderTradeDeposit is a pokemon waiting in the wonder trade pool to be
+// swapped with the next depositor's pokemon
+type WonderTradeDeposit struct {
+	ID             uint         `json:"id" gorm:"primary_key"`
+	UserID         uint         `json:"userId" gorm:"index"`
+	OwnedPokemonID uint         `json:"ownedPokemonId" gorm:"uniqueIndex"`
+	OwnedPokemon   OwnedPokemon `json:"ownedPokemon"`
+	CreatedAt      int64        `json:"createdAt" gorm:"autoCreateTime:milli"`
+}
@@ -1,6 +1,9 @@
 package models
 
-import "susie.mx/gokemon/dbtypes"
+import (
+	"gorm.io/gorm"
+	"susie.mx/gokemon/dbtypes"
+)
 
 type User struct {
 	ID                uint   `json:"id" gorm:"primary_key"`
@@ -8,11 +11,24 @@ type User struct {
 	Username          string `json:"username"`
 	ProfilePictureURL string `json:"profilePictureUrl"`
 	// OwnedPokemonOld               []Pokemon      `json:"ownedPokemon" gorm:"many2many:user_pokemon;"`
-	OwnedPokemon                  []OwnedPokemon `json:"ownedPokemon" gorm:"foreignKey:OwnerID"`
-	PendingPokemon                []OwnedPokemon `json:"pendingPokemon" gorm:"foreignKey:PendingOwnerID"`
-	Friends                       []*User        `json:"friends" gorm:"many2many:user_friends"`
-	NextPokemonSelectionTimestamp int64          `json:"nextPokemonSelectionTimestamp"`
-	PreferredForms                dbtypes.JSON   `json:"preferredForms" gorm:"type:jsonb"`
+	OwnedPokemon                  []OwnedPokemon    `json:"ownedPokemon" gorm:"foreignKey:OwnerID"`
+	PendingPokemon                []OwnedPokemon    `json:"pendingPokemon" gorm:"foreignKey:PendingOwnerID"`
+	HeldPokemon                   []OwnedPokemon    `json:"heldPokemon" gorm:"foreignKey:HeldOwnerID"`
+	Friends                       []*User           `json:"friends" gorm:"many2many:user_friends"`
+	NextPokemonSelectionTimestamp int64             `json:"nextPokemonSelectionTimestamp"`
+	PreferredForms                dbtypes.JSON      `json:"preferredForms" gorm:"type:jsonb"`
+	Achievements                  []UserAchievement `json:"achievements"`
+	IsAdmin                       bool              `json:"isAdmin"`
+	EncounterStats                EncounterStats    `json:"encounterStats"`
+	Location                      string            `json:"location"`
+	Timezone                      string            `json:"timezone"`
+	// Rerolls used on RerollDay, in the user's time zone
+	RerollDay   string `json:"rerollDay"`
+	RerollCount uint   `json:"rerollCount"`
+	// Loaded separately, since it is one of the user's teams
+	ActiveTeam *Team `json:"activeTeam" gorm:"-"`
+	// Only loaded for the logged in user, other users' balances are private
+	Wallet []WalletBalance `json:"wallet,omitempty" gorm:"-"`
 }
 
 type OwnedPokemon struct {
@@ -21,10 +37,38 @@ type OwnedPokemon struct {
 	Pokemon        Pokemon `json:"pokemon"`
 	OwnerID        *uint   `json:"ownerId"`
 	PendingOwnerID *uint   `json:"pendingOwnerId"`
+	HeldOwnerID    *uint   `json:"heldOwnerId"`
 	FormIndex      uint    `json:"formIndex"`
 	IsShiny        bool    `json:"isShiny"`
+	CaughtByID     *uint   `json:"caughtById"`
+	CaughtBy       *User   `json:"caughtBy,omitempty"`
+	CaughtAt       int64   `json:"caughtAt"`
+	// The defaults must match StartingLevel and BaseFriendship in the server
+	Level      uint `json:"level" gorm:"default:5"`
+	Friendship uint `json:"friendship" gorm:"default:70"`
+	// Released pokemon are kept for trade history and provenance
+	DeletedAt gorm.DeletedAt `json:"releasedAt" gorm:"index"`
+	Nature    string         `json:"nature"`
+	IVs       Stats          `json:"ivs" gorm:"embedded;embeddedPrefix:iv_"`
+	Gender    uint           `json:"gender"`
+	Ability   string         `json:"ability"`
+	// The nickname stays with the pokemon when it is traded, the note and
+	// favorite flag are its owner's own
+	Nickname   string `json:"nickname"`
+	IsFavorite bool   `json:"isFavorite"`
+	// Only served to the owner, by the notes endpoint
+	Note string `json:"-"`
 }
 
+// Genders are numbered like PokeAPI does. Pokemon caught before genders were
+// rolled have none.
+const (
+	GenderNone       = 0
+	GenderFemale     = 1
+	GenderMale       = 2
+	GenderGenderless = 3
+)
+
 type FriendRequest struct {
 	ID       uint `json:"id" gorm:"primary_key"`
 	UserID   uint `json:"userId"`
@@ -33,14 +77,27 @@ type FriendRequest struct {
 	Friend   User `json:"friend"`
 }
 
+const (
+	TradeRequestOpen        = "open"
+	TradeRequestAccepted    = "accepted"
+	TradeRequestDeclined    = "declined"
+	TradeRequestCountered   = "countered"
+	TradeRequestExpired     = "expired"
+	TradeRequestInvalidated = "invalidated"
+)
+
 type TradeRequest struct {
-	ID              uint         `json:"id" gorm:"primary_key"`
-	UserID          uint         `json:"userId"`
-	User            User         `json:"user"`
-	UserPokemonID   uint         `json:"userPokemonId"`
-	UserPokemon     OwnedPokemon `json:"userPokemon"`
-	FriendID        uint         `json:"friendId"`
-	Friend          User         `json:"friend"`
-	FriendPokemonID uint         `json:"friendPokemonId"`
-	FriendPokemon   OwnedPokemon `json:"friendPokemon"`
+	ID             uint           `json:"id" gorm:"primary_key"`
+	ThreadID       uint           `json:"threadId" gorm:"index"`
+	SupersededByID *uint          `json:"supersededById"`
+	Status         string         `json:"status" gorm:"default:open;index"`
+	UserID         uint           `json:"userId"`
+	User           User           `json:"user"`
+	UserPokemon    []OwnedPokemon `json:"userPokemon" gorm:"many2many:trade_request_user_pokemon"`
+	FriendID       uint           `json:"friendId"`
+	Friend         User           `json:"friend"`
+	FriendPokemon  []OwnedPokemon `json:"friendPokemon" gorm:"many2many:trade_request_friend_pokemon"`
+	CreatedAt      int64          `json:"createdAt" gorm:"autoCreateTime:milli"`
+	ExpiresAt      int64          `json:"expiresAt"`
+	ClosedAt       int64          `json:"closedAt"`
 }
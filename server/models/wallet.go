@@ -0,0 +1,33 @@
+package models
+
+const (
+	ResourceDust  = "dust"
+	ResourceCandy = "candy"
+)
+
+const (
+	WalletReasonRelease = "release"
+	WalletReasonLevelUp = "levelUp"
+)
+
+type WalletBalance struct {
+	ID       uint   `json:"-" gorm:"primary_key"`
+	UserID   uint   `json:"userId" gorm:"uniqueIndex:idx_wallet_balances_user_resource"`
+	Resource string `json:"resource" gorm:"uniqueIndex:idx_wallet_balances_user_resource"`
+	// The species candy belongs to, 0 for dust
+	PokemonID uint  `json:"pokemonId" gorm:"uniqueIndex:idx_wallet_balances_user_resource"`
+	Amount    int64 `json:"amount"`
+}
+
+// WalletTransaction is an append-only record of a change to a wallet balance
+type WalletTransaction struct {
+	ID        uint   `json:"id" gorm:"primary_key"`
+	UserID    uint   `json:"userId" gorm:"index"`
+	Resource  string `json:"resource"`
+	PokemonID uint   `json:"pokemonId"`
+	// Negative when spent
+	Amount         int64  `json:"amount"`
+	Reason         string `json:"reason"`
+	OwnedPokemonID *uint  `json:"ownedPokemonId"`
+	CreatedAt      int64  `json:"createdAt" gorm:"autoCreateTime:milli"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// WishlistEntry is a pokemon a user is hunting for. A nil FormIndex or IsShiny
+// matches any form or shininess.
+type WishlistEntry struct {
+	ID        uint    `json:"id" gorm:"primary_key"`
+	UserID    uint    `json:"userId" gorm:"index"`
+	PokemonID uint    `json:"pokemonId"`
+	Pokemon   Pokemon `json:"pokemon"`
+	FormIndex *uint   `json:"formIndex"`
+	IsShiny   *bool   `json:"isShiny"`
+}
@@ -0,0 +1,60 @@
+package pokeapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type EvolutionChain struct {
+	ID    int       `json:"id"`
+	Chain ChainLink `json:"chain"`
+}
+
+type ChainLink struct {
+	Species NamedResource `json:"species"`
+	// How this link's species evolves from the link above it, one entry per
+	// alternative way to evolve
+	EvolutionDetails []EvolutionDetail `json:"evolution_details"`
+	EvolvesTo        []ChainLink       `json:"evolves_to"`
+}
+
+type EvolutionDetail struct {
+	Trigger               NamedResource  `json:"trigger"`
+	MinLevel              *int           `json:"min_level"`
+	Item                  *NamedResource `json:"item"`
+	HeldItem              *NamedResource `json:"held_item"`
+	MinHappiness          *int           `json:"min_happiness"`
+	MinAffection          *int           `json:"min_affection"`
+	MinBeauty             *int           `json:"min_beauty"`
+	TradeSpecies          *NamedResource `json:"trade_species"`
+	TimeOfDay             string         `json:"time_of_day"`
+	Gender                *int           `json:"gender"`
+	KnownMove             *NamedResource `json:"known_move"`
+	KnownMoveType         *NamedResource `json:"known_move_type"`
+	Location              *NamedResource `json:"location"`
+	PartySpecies          *NamedResource `json:"party_species"`
+	PartyType             *NamedResource `json:"party_type"`
+	RelativePhysicalStats *int           `json:"relative_physical_stats"`
+	NeedsOverworldRain    bool           `json:"needs_overworld_rain"`
+	TurnUpsideDown        bool           `json:"turn_upside_down"`
+}
+
+func GetEvolutionChain(id string) (EvolutionChain, error) {
+	url := fmt.Sprintf("https://pokeapi.co/api/v2/evolution-chain/%s", id)
+	res, err := http.Get(url)
+	if err != nil {
+		return EvolutionChain{}, fmt.Errorf("getting evolution chain(%s) failed: %w", id, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return EvolutionChain{}, ApiError{URL: url, Response: res}
+	}
+	decoder := json.NewDecoder(res.Body)
+	var chain EvolutionChain
+	err = decoder.Decode(&chain)
+	if err != nil {
+		return EvolutionChain{}, fmt.Errorf("decoding json into evolution chain(%s) failed: %w", id, err)
+	}
+	return chain, nil
+}
@@ -30,3 +30,11 @@ func TestPokemonForm(t *testing.T) {
 	}
 	fmt.Printf("%#v", p)
 }
+
+func TestEvolutionChain(t *testing.T) {
+	c, err := pokeapi.GetEvolutionChain("1")
+	if err != nil {
+		t.Fatalf("failed to get evolution chain: %s", err)
+	}
+	fmt.Printf("%#v", c)
+}
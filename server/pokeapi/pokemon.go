@@ -12,6 +12,15 @@ type Pokemon struct {
 		Name string `json:"name"`
 		URL  string `json:"url"`
 	}
+	Stats []struct {
+		BaseStat int           `json:"base_stat"`
+		Stat     NamedResource `json:"stat"`
+	} `json:"stats"`
+	Abilities []struct {
+		Ability  NamedResource `json:"ability"`
+		IsHidden bool          `json:"is_hidden"`
+		Slot     int           `json:"slot"`
+	} `json:"abilities"`
 }
 
 func GetPokemon(id string) (Pokemon, error) {
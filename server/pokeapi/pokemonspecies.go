@@ -14,9 +14,13 @@ type PokemonSpecies struct {
 		} `json:"language"`
 		Name string `json:"name"`
 	} `json:"names"`
-	HasGenderDifferences bool `json:"has_gender_differences"`
-	IsLegendary          bool `json:"is_legendary"`
-	IsMythical           bool `json:"is_mythical"`
+	HasGenderDifferences bool           `json:"has_gender_differences"`
+	IsLegendary          bool           `json:"is_legendary"`
+	IsMythical           bool           `json:"is_mythical"`
+	Generation           NamedResource  `json:"generation"`
+	Habitat              *NamedResource `json:"habitat"`
+	EvolutionChain       NamedResource  `json:"evolution_chain"`
+	GenderRate           int            `json:"gender_rate"`
 	Varieties            []struct {
 		Pokemon struct {
 			Name string `json:"name"`
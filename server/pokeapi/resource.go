@@ -0,0 +1,23 @@
+package pokeapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type NamedResource struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// ID returns the id at the end of the resource's url, e.g. 3 for
+// https://pokeapi.co/api/v2/generation/3/
+func (r NamedResource) ID() (int, error) {
+	parts := strings.Split(strings.TrimSuffix(r.URL, "/"), "/")
+	id, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return 0, fmt.Errorf("parsing id of resource(%s) failed: %w", r.URL, err)
+	}
+	return id, nil
+}
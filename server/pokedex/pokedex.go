@@ -0,0 +1,183 @@
+package pokedex
+
+import (
+	"sort"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"susie.mx/gokemon/models"
+)
+
+type Completion struct {
+	Seen          int     `json:"seen"`
+	Caught        int     `json:"caught"`
+	Total         int     `json:"total"`
+	SeenPercent   float64 `json:"seenPercent"`
+	CaughtPercent float64 `json:"caughtPercent"`
+}
+
+func (c *Completion) add(seen bool, caught bool) {
+	c.Total++
+	if seen {
+		c.Seen++
+	}
+	if caught {
+		c.Caught++
+	}
+}
+
+func (c *Completion) computePercentages() {
+	if c.Total == 0 {
+		return
+	}
+	c.SeenPercent = 100 * float64(c.Seen) / float64(c.Total)
+	c.CaughtPercent = 100 * float64(c.Caught) / float64(c.Total)
+}
+
+type FormEntry struct {
+	FormIndex   uint   `json:"formIndex"`
+	Name        string `json:"name"`
+	Seen        bool   `json:"seen"`
+	Caught      bool   `json:"caught"`
+	SeenShiny   bool   `json:"seenShiny"`
+	CaughtShiny bool   `json:"caughtShiny"`
+}
+
+type SpeciesEntry struct {
+	PokemonID   uint        `json:"pokemonId"`
+	Name        string      `json:"name"`
+	Generation  uint        `json:"generation"`
+	Seen        bool        `json:"seen"`
+	Caught      bool        `json:"caught"`
+	SeenShiny   bool        `json:"seenShiny"`
+	CaughtShiny bool        `json:"caughtShiny"`
+	Forms       []FormEntry `json:"forms"`
+}
+
+type Pokedex struct {
+	Species     Completion             `json:"species"`
+	Forms       Completion             `json:"forms"`
+	Shiny       Completion             `json:"shiny"`
+	Generations map[uint]*Completion   `json:"generations"`
+	Types       map[string]*Completion `json:"types"`
+	Entries     []SpeciesEntry         `json:"entries"`
+}
+
+type variant struct {
+	pokemonID uint
+	formIndex uint
+	isShiny   bool
+}
+
+// Compute works out a user's progress through the given pokemon from their
+// pokedex entries. Species count towards every type any of their forms have.
+func Compute(pokemon []models.Pokemon, entries []models.PokedexEntry) Pokedex {
+	seen := map[variant]bool{}
+	caught := map[variant]bool{}
+	for _, entry := range entries {
+		v := variant{entry.PokemonID, entry.FormIndex, entry.IsShiny}
+		seen[v] = true
+		if entry.IsCaught {
+			caught[v] = true
+		}
+	}
+
+	// Sort a copy, the caller's pokemon are left as they were
+	pokemon = append([]models.Pokemon(nil), pokemon...)
+	sort.Slice(pokemon, func(i, j int) bool {
+		return pokemon[i].ID < pokemon[j].ID
+	})
+	dex := Pokedex{
+		Generations: map[uint]*Completion{},
+		Types:       map[string]*Completion{},
+		Entries:     []SpeciesEntry{},
+	}
+	for _, p := range pokemon {
+		species := SpeciesEntry{
+			PokemonID:  p.ID,
+			Name:       p.Name,
+			Generation: p.Generation,
+			Forms:      []FormEntry{},
+		}
+		types := map[string]bool{}
+		for i, form := range p.Forms {
+			formIndex := uint(i)
+			entry := FormEntry{
+				FormIndex:   formIndex,
+				Name:        form.Name,
+				Seen:        seen[variant{p.ID, formIndex, false}] || seen[variant{p.ID, formIndex, true}],
+				Caught:      caught[variant{p.ID, formIndex, false}] || caught[variant{p.ID, formIndex, true}],
+				SeenShiny:   seen[variant{p.ID, formIndex, true}],
+				CaughtShiny: caught[variant{p.ID, formIndex, true}],
+			}
+			species.Seen = species.Seen || entry.Seen
+			species.Caught = species.Caught || entry.Caught
+			species.SeenShiny = species.SeenShiny || entry.SeenShiny
+			species.CaughtShiny = species.CaughtShiny || entry.CaughtShiny
+			species.Forms = append(species.Forms, entry)
+			dex.Forms.add(entry.Seen, entry.Caught)
+			for _, t := range form.Types {
+				types[t.Name] = true
+			}
+		}
+		dex.Species.add(species.Seen, species.Caught)
+		dex.Shiny.add(species.SeenShiny, species.CaughtShiny)
+		if _, ok := dex.Generations[p.Generation]; !ok {
+			dex.Generations[p.Generation] = &Completion{}
+		}
+		dex.Generations[p.Generation].add(species.Seen, species.Caught)
+		for t := range types {
+			if _, ok := dex.Types[t]; !ok {
+				dex.Types[t] = &Completion{}
+			}
+			dex.Types[t].add(species.Seen, species.Caught)
+		}
+		dex.Entries = append(dex.Entries, species)
+	}
+
+	dex.Species.computePercentages()
+	dex.Forms.computePercentages()
+	dex.Shiny.computePercentages()
+	for _, c := range dex.Generations {
+		c.computePercentages()
+	}
+	for _, c := range dex.Types {
+		c.computePercentages()
+	}
+	return dex
+}
+
+func Get(db *gorm.DB, userID uint) (Pokedex, error) {
+	var pokemon []models.Pokemon
+	if err := db.Preload("Forms.Types").Preload("Forms").Find(&pokemon).Error; err != nil {
+		return Pokedex{}, err
+	}
+	var entries []models.PokedexEntry
+	if err := db.Find(&entries, "user_id = ?", userID).Error; err != nil {
+		return Pokedex{}, err
+	}
+	return Compute(pokemon, entries), nil
+}
+
+func RecordSeen(tx *gorm.DB, userID uint, pokemon models.OwnedPokemon, now int64) error {
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.PokedexEntry{
+		UserID:      userID,
+		PokemonID:   pokemon.PokemonID,
+		FormIndex:   pokemon.FormIndex,
+		IsShiny:     pokemon.IsShiny,
+		FirstSeenAt: now,
+	}).Error
+}
+
+func RecordCaught(tx *gorm.DB, userID uint, pokemon models.OwnedPokemon, now int64) error {
+	if err := RecordSeen(tx, userID, pokemon, now); err != nil {
+		return err
+	}
+	return tx.Model(&models.PokedexEntry{}).
+		Where("user_id = ? AND pokemon_id = ? AND form_index = ? AND is_shiny = ? AND NOT is_caught",
+			userID, pokemon.PokemonID, pokemon.FormIndex, pokemon.IsShiny).
+		Updates(map[string]interface{}{
+			"is_caught":       true,
+			"first_caught_at": now,
+		}).Error
+}
@@ -0,0 +1,177 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"susie.mx/gokemon/models"
+)
+
+const PollInterval = time.Minute
+const RetryBackoff = 30 * time.Second
+const MaxRetryBackoff = 10 * time.Minute
+const MinPollInterval = time.Second
+
+// A Handler runs a due job inside the transaction that removes the job, so the
+// job is only considered done if the handler's writes are committed as well.
+type Handler func(tx *gorm.DB, job models.Job) error
+
+type Scheduler struct {
+	db       *gorm.DB
+	handlers map[string]Handler
+	wake     chan struct{}
+}
+
+func New(db *gorm.DB) *Scheduler {
+	return &Scheduler{
+		db:       db,
+		handlers: map[string]Handler{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Handle registers the handler for a job kind. It must be called before Run.
+func (s *Scheduler) Handle(kind string, handler Handler) {
+	s.handlers[kind] = handler
+}
+
+// Schedule creates the job for (kind, subjectID) or moves an existing one to
+// runAt. db may be a transaction, in which case the job only exists once it
+// commits.
+func (s *Scheduler) Schedule(db *gorm.DB, kind string, subjectID uint, runAt time.Time) error {
+	job := models.Job{
+		Kind:      kind,
+		SubjectID: subjectID,
+		RunAt:     runAt.UnixMilli(),
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "kind"}, {Name: "subject_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"run_at", "attempts", "last_error"}),
+	}).Create(&job).Error
+	if err != nil {
+		return fmt.Errorf("scheduling job(%s/%d) failed: %w", kind, subjectID, err)
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *Scheduler) Cancel(db *gorm.DB, kind string, subjectID uint) error {
+	err := db.Delete(&models.Job{}, "kind = ? AND subject_id = ?", kind, subjectID).Error
+	if err != nil {
+		return fmt.Errorf("cancelling job(%s/%d) failed: %w", kind, subjectID, err)
+	}
+	return nil
+}
+
+// Run processes due jobs until ctx is cancelled. A job that is already running
+// when ctx is cancelled is allowed to finish.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		for ctx.Err() == nil {
+			ran, err := s.runNext()
+			if err != nil {
+				log.Printf("running job failed: %s", err)
+			}
+			if !ran {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-time.After(s.nextDelay()):
+		}
+	}
+}
+
+func (s *Scheduler) runNext() (bool, error) {
+	var job models.Job
+	found := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("run_at <= ?", time.Now().UnixMilli()).
+			Order("run_at").
+			Limit(1).
+			Find(&job)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		found = true
+		handler, ok := s.handlers[job.Kind]
+		if !ok {
+			return fmt.Errorf("no handler registered for job kind '%s'", job.Kind)
+		}
+		if err := runHandler(handler, tx, job); err != nil {
+			return err
+		}
+		// The handler may have rescheduled its own job, in which case it must survive
+		return tx.Where("run_at = ?", job.RunAt).Delete(&job).Error
+	})
+	if err != nil && found {
+		err = fmt.Errorf("job(%s/%d) failed: %w", job.Kind, job.SubjectID, err)
+		s.recordFailure(job, err)
+	}
+	return found, err
+}
+
+func runHandler(handler Handler, tx *gorm.DB, job models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handler(tx, job)
+}
+
+// retryDelay is how long to wait before retrying a job that has failed the given
+// number of times. Jobs are never given up on, since users would be left waiting
+// for them with no way to get them going again.
+func retryDelay(attempts uint) time.Duration {
+	delay := time.Duration(attempts) * RetryBackoff
+	if delay > MaxRetryBackoff {
+		return MaxRetryBackoff
+	}
+	return delay
+}
+
+func (s *Scheduler) recordFailure(job models.Job, jobErr error) {
+	attempts := job.Attempts + 1
+	runAt := time.Now().Add(retryDelay(attempts)).UnixMilli()
+	err := s.db.Model(&models.Job{}).
+		Where("id = ? AND run_at = ?", job.ID, job.RunAt).
+		Updates(map[string]interface{}{
+			"attempts":   attempts,
+			"last_error": jobErr.Error(),
+			"run_at":     runAt,
+		}).Error
+	if err != nil {
+		log.Printf("recording failure of job(%s/%d) failed: %s", job.Kind, job.SubjectID, err)
+	}
+}
+
+func (s *Scheduler) nextDelay() time.Duration {
+	var job models.Job
+	result := s.db.Order("run_at").Limit(1).Find(&job)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return PollInterval
+	}
+	delay := time.Until(time.UnixMilli(job.RunAt))
+	if delay < MinPollInterval {
+		return MinPollInterval
+	}
+	if delay > PollInterval {
+		return PollInterval
+	}
+	return delay
+}
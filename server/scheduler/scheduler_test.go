@@ -0,0 +1,142 @@
+package scheduler
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"susie.mx/gokemon/models"
+)
+
+func newMockScheduler(t *testing.T) (*Scheduler, sqlmock.Sqlmock) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("creating mock database failed: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("opening mock database failed: %s", err)
+	}
+	return New(db), mock
+}
+
+func jobRows(jobs ...models.Job) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "kind", "subject_id", "run_at", "attempts", "last_error"})
+	for _, job := range jobs {
+		rows.AddRow(job.ID, job.Kind, job.SubjectID, job.RunAt, job.Attempts, job.LastError)
+	}
+	return rows
+}
+
+func TestRetryDelay(t *testing.T) {
+	if delay := retryDelay(1); delay != RetryBackoff {
+		t.Fatalf("expected the first retry after %s, got %s", RetryBackoff, delay)
+	}
+	if delay := retryDelay(3); delay != 3*RetryBackoff {
+		t.Fatalf("expected the third retry after %s, got %s", 3*RetryBackoff, delay)
+	}
+	if delay := retryDelay(1000); delay != MaxRetryBackoff {
+		t.Fatalf("expected retries to back off at most %s, got %s", MaxRetryBackoff, delay)
+	}
+}
+
+func TestNextDelay(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		jobs []models.Job
+		min  time.Duration
+		max  time.Duration
+	}{
+		{"no jobs", nil, PollInterval, PollInterval},
+		{"overdue job", []models.Job{{ID: 1, RunAt: now.Add(-time.Hour).UnixMilli()}}, MinPollInterval, MinPollInterval},
+		{"distant job", []models.Job{{ID: 1, RunAt: now.Add(time.Hour).UnixMilli()}}, PollInterval, PollInterval},
+		{"upcoming job", []models.Job{{ID: 1, RunAt: now.Add(10 * time.Second).UnixMilli()}}, 9 * time.Second, 10 * time.Second},
+		// Failed jobs are still waited for, they are never given up on
+		{"failed job", []models.Job{{ID: 1, RunAt: now.Add(10 * time.Second).UnixMilli(), Attempts: 100}}, 9 * time.Second, 10 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, mock := newMockScheduler(t)
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "jobs" ORDER BY run_at LIMIT 1`)).
+				WillReturnRows(jobRows(test.jobs...))
+			delay := s.nextDelay()
+			if delay < test.min || delay > test.max {
+				t.Fatalf("expected a delay between %s and %s, got %s", test.min, test.max, delay)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRunNextKeepsRescheduledJob(t *testing.T) {
+	s, mock := newMockScheduler(t)
+	job := models.Job{ID: 1, Kind: "test", SubjectID: 7, RunAt: time.Now().Add(-time.Minute).UnixMilli()}
+	rescheduledAt := time.Now().Add(time.Hour)
+	s.Handle("test", func(tx *gorm.DB, job models.Job) error {
+		return s.Schedule(tx, job.Kind, job.SubjectID, rescheduledAt)
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "jobs" WHERE run_at <= \$1 ORDER BY run_at LIMIT 1 FOR UPDATE SKIP LOCKED`).
+		WillReturnRows(jobRows(job))
+	mock.ExpectQuery(`INSERT INTO "jobs" .* ON CONFLICT \("kind","subject_id"\) DO UPDATE`).
+		WithArgs(job.Kind, job.SubjectID, rescheduledAt.UnixMilli(), 0, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(job.ID))
+	// Only the run the handler was given is deleted, which no longer matches
+	// once the handler has moved the job
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "jobs" WHERE run_at = $1 AND "jobs"."id" = $2`)).
+		WithArgs(job.RunAt, job.ID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	ran, err := s.runNext()
+	if err != nil {
+		t.Fatalf("running job failed: %s", err)
+	}
+	if !ran {
+		t.Fatalf("expected the due job to run")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunNextRetriesFailedJob(t *testing.T) {
+	s, mock := newMockScheduler(t)
+	job := models.Job{ID: 1, Kind: "test", SubjectID: 7, RunAt: time.Now().Add(-time.Minute).UnixMilli(), Attempts: 100}
+	s.Handle("test", func(tx *gorm.DB, job models.Job) error {
+		return errors.New("database went away")
+	})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "jobs" WHERE run_at <= \$1`).
+		WillReturnRows(jobRows(job))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "jobs" SET "attempts"=\$1,"last_error"=\$2,"run_at"=\$3 WHERE id = \$4 AND run_at = \$5`).
+		WithArgs(job.Attempts+1, sqlmock.AnyArg(), sqlmock.AnyArg(), job.ID, job.RunAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ran, err := s.runNext()
+	if err == nil {
+		t.Fatalf("expected the handler's error")
+	}
+	if !ran {
+		t.Fatalf("expected the due job to run")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
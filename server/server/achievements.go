@@ -0,0 +1,39 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"susie.mx/gokemon/achievements"
+)
+
+func (s *Server) GetAchievements(c *gin.Context) {
+	c.JSON(http.StatusOK, achievements.Rules)
+}
+
+// awardAchievements evaluates achievements for the users involved in an event
+// after it has been committed. Failing to award an achievement never fails the
+// request that triggered it.
+func (s *Server) awardAchievements(event achievements.Event, userIDs ...uint) {
+	for _, userID := range userIDs {
+		err := s.DB.Transaction(func(tx *gorm.DB) error {
+			earned, err := achievements.Evaluate(tx, userID, event)
+			if err != nil {
+				return err
+			}
+			for _, rule := range earned {
+				err := notify(tx, userID, fmt.Sprintf("You earned the %s badge: %s!", rule.Name, rule.Description))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("awarding achievements to user(%d) failed: %s", userID, err)
+		}
+	}
+}
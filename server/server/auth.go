@@ -34,7 +34,9 @@ func (s *Server) DiscordLogin(c *gin.Context) {
 			NextPokemonSelectionTimestamp: time.Now().Add(time.Minute).UnixMilli(),
 		}
 		s.DB.Create(&newUser)
-		s.NewPokemonTimer(newUser.ID)
+		if err := s.ScheduleNewPokemon(s.DB, newUser); err != nil {
+			log.Panicf("scheduling first pokemon failed: %s", err)
+		}
 	} else {
 		username = user.Username
 	}
@@ -0,0 +1,624 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"susie.mx/gokemon/battle"
+	"susie.mx/gokemon/models"
+)
+
+var (
+	ErrBattleNotFound       = ApiError{http.StatusNotFound, "battle not found"}
+	ErrNotInBattle          = ApiError{http.StatusForbidden, "not part of this battle"}
+	ErrBattleWithSelf       = ApiError{http.StatusBadRequest, "can not battle with self"}
+	ErrBattleNotFriends     = ApiError{http.StatusBadRequest, "must be friends to battle"}
+	ErrBattleTeamSize       = ApiError{http.StatusBadRequest, fmt.Sprintf("a battle team must have between 1 and %d pokemon", battle.MaxTeamSize)}
+	ErrDuplicateTeamPokemon = ApiError{http.StatusBadRequest, "a pokemon can only be in a team once"}
+	ErrBattleTeamNotOwned   = ApiError{http.StatusBadRequest, "can only battle with pokemon you own"}
+	ErrNotChallenged        = ApiError{http.StatusForbidden, "only the challenged user can accept a battle"}
+	ErrBattleNotChallenged  = ApiError{http.StatusConflict, "battle has already been accepted or closed"}
+	ErrBattleNotActive      = ApiError{http.StatusConflict, "battle is not in progress"}
+	ErrBattleClosed         = ApiError{http.StatusConflict, "battle is already over"}
+	ErrActionSubmitted      = ApiError{http.StatusConflict, "already chose an action this turn"}
+	ErrInvalidBattleAction  = ApiError{http.StatusBadRequest, "that action is not possible right now"}
+)
+
+// BattleView is a battle along with its state after the turns played so far.
+// Actions chosen for the current turn stay hidden, only whether each side has
+// chosen one is shown.
+type BattleView struct {
+	Battle           models.Battle  `json:"battle"`
+	State            *battle.Battle `json:"state,omitempty"`
+	WaitingForUser   bool           `json:"waitingForUser"`
+	WaitingForFriend bool           `json:"waitingForFriend"`
+}
+
+func preloadBattles(db *gorm.DB) *gorm.DB {
+	return db.Preload("User").
+		Preload("Friend").
+		Preload("Members.Pokemon.Forms.Sprites").
+		Preload("Members.Pokemon.Forms.Types").
+		Preload("Members.Pokemon.Forms").
+		Preload("Members.Pokemon").
+		Preload("Members", func(db *gorm.DB) *gorm.DB {
+			return db.Order("side, position")
+		}).
+		Preload("Actions", func(db *gorm.DB) *gorm.DB {
+			return db.Order("turn, side")
+		})
+}
+
+// battleSide is the side the user is on, or -1 if they are not in the battle
+func battleSide(b models.Battle, userID uint) int {
+	switch userID {
+	case b.UserID:
+		return 0
+	case b.FriendID:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// battleState replays the resolved turns of a battle. It needs the battle's
+// members and actions preloaded like preloadBattles does.
+func battleState(b models.Battle) (*battle.Battle, error) {
+	var teams [2][]models.OwnedPokemon
+	for _, member := range b.Members {
+		teams[member.Side] = append(teams[member.Side], models.OwnedPokemon{
+			ID:        member.OwnedPokemonID,
+			PokemonID: member.PokemonID,
+			Pokemon:   member.Pokemon,
+			FormIndex: member.FormIndex,
+			Level:     member.Level,
+			Nature:    member.Nature,
+			IVs:       member.IVs,
+			Nickname:  member.Nickname,
+		})
+	}
+	turns := make([][2]battle.Action, b.Turn)
+	for _, action := range b.Actions {
+		if action.Turn <= b.Turn {
+			turns[action.Turn-1][action.Side] = battle.Action{
+				Kind:  battle.ActionKind(action.Kind),
+				Index: action.Index,
+			}
+		}
+	}
+	return battle.Replay(b.Seed, teams, turns)
+}
+
+func newBattleView(b models.Battle) (BattleView, error) {
+	view := BattleView{Battle: b}
+	if b.Status != models.BattleActive && b.Status != models.BattleFinished {
+		return view, nil
+	}
+	state, err := battleState(b)
+	if err != nil {
+		return BattleView{}, err
+	}
+	view.State = state
+	if b.Status == models.BattleActive {
+		view.WaitingForUser, view.WaitingForFriend = true, true
+		for _, action := range b.Actions {
+			if action.Turn == b.Turn+1 {
+				if action.Side == 0 {
+					view.WaitingForUser = false
+				} else {
+					view.WaitingForFriend = false
+				}
+			}
+		}
+	}
+	return view, nil
+}
+
+// battleTeam loads the pokemon for a user's battle team in the given order, or
+// the members of their saved team if a team is given
+func battleTeam(tx *gorm.DB, userID uint, pokemonIDs []uint, teamID *uint) ([]models.OwnedPokemon, error) {
+	if teamID != nil {
+		var team models.Team
+		err := tx.Preload("Members", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position")
+		}).First(&team, *teamID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && team.UserID != userID) {
+			return nil, ErrTeamNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		pokemonIDs = nil
+		for _, member := range team.Members {
+			pokemonIDs = append(pokemonIDs, member.OwnedPokemonID)
+		}
+	}
+	if len(pokemonIDs) == 0 || len(pokemonIDs) > battle.MaxTeamSize {
+		return nil, ErrBattleTeamSize
+	}
+	var pokemon []models.OwnedPokemon
+	if err := tx.Find(&pokemon, pokemonIDs).Error; err != nil {
+		return nil, err
+	}
+	byID := map[uint]models.OwnedPokemon{}
+	for _, p := range pokemon {
+		byID[p.ID] = p
+	}
+	team := make([]models.OwnedPokemon, len(pokemonIDs))
+	seen := map[uint]bool{}
+	for i, id := range pokemonIDs {
+		if seen[id] {
+			return nil, ErrDuplicateTeamPokemon
+		}
+		seen[id] = true
+		p, ok := byID[id]
+		if !ok || !isOwnedBy(p, userID) {
+			return nil, ErrBattleTeamNotOwned
+		}
+		team[i] = p
+	}
+	return team, nil
+}
+
+func battleMembers(side uint, team []models.OwnedPokemon) []models.BattleMember {
+	members := make([]models.BattleMember, len(team))
+	for i, p := range team {
+		members[i] = models.BattleMember{
+			Side:           side,
+			Position:       uint(i),
+			OwnedPokemonID: p.ID,
+			PokemonID:      p.PokemonID,
+			FormIndex:      p.FormIndex,
+			Level:          p.Level,
+			Nature:         p.Nature,
+			IVs:            p.IVs,
+			Nickname:       p.Nickname,
+			IsShiny:        p.IsShiny,
+			Gender:         p.Gender,
+		}
+	}
+	return members
+}
+
+// lockBattle locks a battle the user takes part in and loads everything
+// needed to replay it
+func lockBattle(tx *gorm.DB, battleID uint, userID uint) (models.Battle, error) {
+	var b models.Battle
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&b, battleID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return b, ErrBattleNotFound
+	}
+	if err != nil {
+		return b, err
+	}
+	if battleSide(b, userID) == -1 {
+		return b, ErrNotInBattle
+	}
+	err = preloadBattles(tx).First(&b, b.ID).Error
+	return b, err
+}
+
+func (s *Server) GetBattles(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	var battles []models.Battle
+	err := preloadBattles(s.DB).
+		Order("id").
+		Find(&battles, "user_id = ? OR friend_id = ?", user.ID, user.ID).Error
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	sentBattles := []BattleView{}
+	receivedBattles := []BattleView{}
+	activeBattles := []BattleView{}
+	closedBattles := []BattleView{}
+	includeClosed := c.Query("includeClosed") == "true"
+	for _, b := range battles {
+		if !includeClosed && b.Status != models.BattleChallenged && b.Status != models.BattleActive {
+			continue
+		}
+		view, err := newBattleView(b)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+		// The full log of a closed battle is only sent with its replay
+		if view.State != nil && b.Status != models.BattleActive {
+			view.State = nil
+		}
+		switch {
+		case b.Status == models.BattleActive:
+			activeBattles = append(activeBattles, view)
+		case b.Status != models.BattleChallenged:
+			closedBattles = append(closedBattles, view)
+		case b.UserID == user.ID:
+			sentBattles = append(sentBattles, view)
+		default:
+			receivedBattles = append(receivedBattles, view)
+		}
+	}
+	obj := gin.H{
+		"sent":     sentBattles,
+		"received": receivedBattles,
+		"active":   activeBattles,
+	}
+	if includeClosed {
+		obj["closed"] = closedBattles
+	}
+	c.JSON(http.StatusOK, obj)
+}
+
+type PostBattleRequest struct {
+	FriendID   uint   `json:"friendId"`
+	PokemonIDs []uint `json:"pokemonIds"`
+	// Battles with a saved team instead of the given pokemon
+	TeamID *uint `json:"teamId"`
+}
+
+// PostBattle challenges a friend to a battle with the given team
+func (s *Server) PostBattle(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
+		})
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	var request PostBattleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid battle challenge",
+		})
+		return
+	}
+	var b models.Battle
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if request.FriendID == user.ID {
+			return ErrBattleWithSelf
+		}
+		friends, err := areFriends(tx, user.ID, request.FriendID)
+		if err != nil {
+			return err
+		}
+		if !friends {
+			return ErrBattleNotFriends
+		}
+		team, err := battleTeam(tx, user.ID, request.PokemonIDs, request.TeamID)
+		if err != nil {
+			return err
+		}
+		b = models.Battle{
+			Status:   models.BattleChallenged,
+			UserID:   user.ID,
+			FriendID: request.FriendID,
+			Seed:     rand.Int63(),
+			Members:  battleMembers(0, team),
+		}
+		if err := tx.Create(&b).Error; err != nil {
+			return err
+		}
+		return notify(tx, request.FriendID, fmt.Sprintf("%s challenged you to a battle!", user.Username))
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, b)
+}
+
+type AcceptBattleRequest struct {
+	BattleID   uint   `json:"battleId"`
+	PokemonIDs []uint `json:"pokemonIds"`
+	TeamID     *uint  `json:"teamId"`
+}
+
+// AcceptBattle starts a battle the user was challenged to, with their team
+func (s *Server) AcceptBattle(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
+		})
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	var request AcceptBattleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid battle",
+		})
+		return
+	}
+	var view BattleView
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		b, err := lockBattle(tx, request.BattleID, user.ID)
+		if err != nil {
+			return err
+		}
+		if b.FriendID != user.ID {
+			return ErrNotChallenged
+		}
+		if b.Status != models.BattleChallenged {
+			return ErrBattleNotChallenged
+		}
+		team, err := battleTeam(tx, user.ID, request.PokemonIDs, request.TeamID)
+		if err != nil {
+			return err
+		}
+		members := battleMembers(1, team)
+		for i := range members {
+			members[i].BattleID = b.ID
+		}
+		if err := tx.Create(&members).Error; err != nil {
+			return err
+		}
+		err = tx.Model(&b).Updates(map[string]interface{}{
+			"status":      models.BattleActive,
+			"accepted_at": time.Now().UnixMilli(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := notify(tx, b.UserID, fmt.Sprintf("%s accepted your battle challenge!", user.Username)); err != nil {
+			return err
+		}
+		if err := preloadBattles(tx).First(&b, b.ID).Error; err != nil {
+			return err
+		}
+		view, err = newBattleView(b)
+		return err
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+type DeleteBattleRequest struct {
+	BattleID uint `json:"battleId"`
+}
+
+// DeleteBattle declines or withdraws a challenge, or forfeits a battle in
+// progress, which makes the other side win
+func (s *Server) DeleteBattle(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	var request DeleteBattleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid battle",
+		})
+		return
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		b, err := lockBattle(tx, request.BattleID, user.ID)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UnixMilli()
+		switch b.Status {
+		case models.BattleChallenged:
+			return tx.Model(&b).Updates(map[string]interface{}{
+				"status":      models.BattleDeclined,
+				"finished_at": now,
+			}).Error
+		case models.BattleActive:
+			winnerID := b.UserID
+			if user.ID == b.UserID {
+				winnerID = b.FriendID
+			}
+			err := tx.Model(&b).Updates(map[string]interface{}{
+				"status":      models.BattleFinished,
+				"winner_id":   winnerID,
+				"forfeited":   true,
+				"finished_at": now,
+			}).Error
+			if err != nil {
+				return err
+			}
+			return notify(tx, winnerID, fmt.Sprintf("%s forfeited your battle, you win!", user.Username))
+		default:
+			return ErrBattleClosed
+		}
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, "ok")
+}
+
+type BattleMoveRequest struct {
+	BattleID uint              `json:"battleId"`
+	Kind     battle.ActionKind `json:"kind"`
+	Index    int               `json:"index"`
+}
+
+// BattleMove chooses the user's action for the current turn. The turn is
+// resolved once both sides have chosen.
+func (s *Server) BattleMove(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
+		})
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	var request BattleMoveRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid battle action",
+		})
+		return
+	}
+	var view BattleView
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		b, err := lockBattle(tx, request.BattleID, user.ID)
+		if err != nil {
+			return err
+		}
+		if b.Status != models.BattleActive {
+			return ErrBattleNotActive
+		}
+		side := battleSide(b, user.ID)
+		turn := b.Turn + 1
+		var opponentAction *models.BattleAction
+		for i, action := range b.Actions {
+			if action.Turn != turn {
+				continue
+			}
+			if action.Side == uint(side) {
+				return ErrActionSubmitted
+			}
+			opponentAction = &b.Actions[i]
+		}
+		state, err := battleState(b)
+		if err != nil {
+			return err
+		}
+		action := battle.Action{Kind: request.Kind, Index: request.Index}
+		if err := state.Validate(side, action); err != nil {
+			return ErrInvalidBattleAction
+		}
+		record := models.BattleAction{
+			BattleID: b.ID,
+			Turn:     turn,
+			Side:     uint(side),
+			Kind:     string(action.Kind),
+			Index:    action.Index,
+		}
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		if opponentAction != nil {
+			if err := s.resolveBattleTurn(tx, &b, state, side, action, *opponentAction); err != nil {
+				return err
+			}
+		}
+		if err := preloadBattles(tx).First(&b, b.ID).Error; err != nil {
+			return err
+		}
+		view, err = newBattleView(b)
+		return err
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+func (s *Server) resolveBattleTurn(tx *gorm.DB, b *models.Battle, state *battle.Battle, side int, action battle.Action, opponentAction models.BattleAction) error {
+	var actions [2]battle.Action
+	actions[side] = action
+	actions[opponentAction.Side] = battle.Action{
+		Kind:  battle.ActionKind(opponentAction.Kind),
+		Index: opponentAction.Index,
+	}
+	if err := state.Play(actions); err != nil {
+		return err
+	}
+	updates := map[string]interface{}{
+		"turn": b.Turn + 1,
+	}
+	var winnerID *uint
+	if state.Over {
+		updates["status"] = models.BattleFinished
+		updates["finished_at"] = time.Now().UnixMilli()
+		switch state.Winner {
+		case 0:
+			winnerID = &b.UserID
+		case 1:
+			winnerID = &b.FriendID
+		}
+		updates["winner_id"] = winnerID
+	}
+	if err := tx.Model(b).Updates(updates).Error; err != nil {
+		return err
+	}
+	if !state.Over {
+		return nil
+	}
+	for _, userID := range []uint{b.UserID, b.FriendID} {
+		message := "Your battle ended in a draw."
+		if winnerID != nil && *winnerID == userID {
+			message = "You won your battle!"
+		} else if winnerID != nil {
+			message = "You lost your battle."
+		}
+		if err := notify(tx, userID, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetBattleReplay returns a battle with its full log, which for a battle in
+// progress covers the turns played so far
+func (s *Server) GetBattleReplay(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid battle id",
+		})
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	var b models.Battle
+	err = preloadBattles(s.DB).First(&b, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		respondWithError(c, ErrBattleNotFound)
+		return
+	}
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	if battleSide(b, user.ID) == -1 {
+		respondWithError(c, ErrNotInBattle)
+		return
+	}
+	view, err := newBattleView(b)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"susie.mx/gokemon/models"
+)
+
+// lockEncounterStats returns the user's encounter stats, creating them if they
+// do not exist yet, and locks them for the rest of tx
+func lockEncounterStats(tx *gorm.DB, userID uint) (models.EncounterStats, error) {
+	stats := models.EncounterStats{UserID: userID}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&stats).Error; err != nil {
+		return stats, err
+	}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&stats, "user_id = ?", userID).Error
+	return stats, err
+}
+
+func recordBatch(tx *gorm.DB, stats *models.EncounterStats, batch []models.OwnedPokemon) error {
+	hasShiny := false
+	for _, p := range batch {
+		stats.TotalEncounters++
+		if p.IsShiny {
+			hasShiny = true
+			stats.ShinyEncounters++
+			stats.EncountersSinceShiny = 0
+		} else {
+			stats.EncountersSinceShiny++
+		}
+	}
+	if hasShiny {
+		stats.BatchesSinceShiny = 0
+	} else {
+		stats.BatchesSinceShiny++
+	}
+	return tx.Save(stats).Error
+}
+
+// recordSelection extends the user's chain if they selected the same species
+// as last time, or starts a new one
+func recordSelection(tx *gorm.DB, userID uint, selected models.OwnedPokemon) error {
+	stats, err := lockEncounterStats(tx, userID)
+	if err != nil {
+		return err
+	}
+	if stats.ChainPokemonID != nil && *stats.ChainPokemonID == selected.PokemonID {
+		stats.ChainLength++
+	} else {
+		stats.ChainPokemonID = &selected.PokemonID
+		stats.ChainLength = 1
+	}
+	if stats.ChainLength > stats.LongestChainLength {
+		stats.LongestChainPokemonID = stats.ChainPokemonID
+		stats.LongestChainLength = stats.ChainLength
+	}
+	return tx.Save(&stats).Error
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ApiError is an error that is safe to show to the client, along with the
+// status code it should be reported with.
+type ApiError struct {
+	Status  int
+	Message string
+}
+
+func (e ApiError) Error() string {
+	return e.Message
+}
+
+func respondWithError(c *gin.Context, err error) {
+	var apiErr ApiError
+	if errors.As(err, &apiErr) {
+		c.JSON(apiErr.Status, gin.H{
+			"error": apiErr.Message,
+		})
+		return
+	}
+	log.Printf("%s %s failed: %s", c.Request.Method, c.Request.URL.Path, err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": "internal server error",
+	})
+}
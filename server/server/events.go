@@ -0,0 +1,195 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"susie.mx/gokemon/events"
+	"susie.mx/gokemon/models"
+)
+
+const AnnounceEventJob = "announceEvent"
+
+var (
+	ErrAdminOnly            = ApiError{http.StatusForbidden, "only admins can manage events"}
+	ErrEventNotFound        = ApiError{http.StatusNotFound, "event not found"}
+	ErrEventName            = ApiError{http.StatusBadRequest, "event must have a name"}
+	ErrEventTimes           = ApiError{http.StatusBadRequest, "event must end after it starts"}
+	ErrEventMultiplier      = ApiError{http.StatusBadRequest, "event multipliers can not be negative"}
+	ErrEventShinyMultiplier = ApiError{http.StatusBadRequest, "event shiny multiplier must be at least 1"}
+	ErrEventNoBoost         = ApiError{http.StatusBadRequest, "event must boost something"}
+	ErrEventBoostedPokemon  = ApiError{http.StatusBadRequest, "boosted pokemon does not exist"}
+	ErrEventBoostedType     = ApiError{http.StatusBadRequest, "boosted type does not exist"}
+)
+
+func (s *Server) GetEvents(c *gin.Context) {
+	now := time.Now()
+	upcoming, err := events.Upcoming(s.DB, now)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	active := []models.Event{}
+	scheduled := []models.Event{}
+	for _, event := range upcoming {
+		if event.StartsAt <= now.UnixMilli() {
+			active = append(active, event)
+		} else {
+			scheduled = append(scheduled, event)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"active":   active,
+		"upcoming": scheduled,
+	})
+}
+
+type PostEventRequest struct {
+	Name                      string  `json:"name"`
+	Description               string  `json:"description"`
+	StartsAt                  int64   `json:"startsAt"`
+	EndsAt                    int64   `json:"endsAt"`
+	BoostedPokemonIDs         []uint  `json:"boostedPokemonIds"`
+	BoostedType               string  `json:"boostedType"`
+	SpawnMultiplier           float64 `json:"spawnMultiplier"`
+	ShinyMultiplier           float64 `json:"shinyMultiplier"`
+	NewPokemonIntervalMinutes uint    `json:"newPokemonIntervalMinutes"`
+}
+
+func (r PostEventRequest) validate() error {
+	if r.Name == "" {
+		return ErrEventName
+	}
+	if r.EndsAt <= r.StartsAt {
+		return ErrEventTimes
+	}
+	if r.SpawnMultiplier < 0 || r.ShinyMultiplier < 0 {
+		return ErrEventMultiplier
+	}
+	// Leaving the shiny multiplier out keeps the normal rate, but it can not
+	// make shinies rarer
+	if r.ShinyMultiplier != 0 && r.ShinyMultiplier < 1 {
+		return ErrEventShinyMultiplier
+	}
+	boostsSpawns := r.SpawnMultiplier > 0 && (len(r.BoostedPokemonIDs) > 0 || r.BoostedType != "")
+	if !boostsSpawns && r.ShinyMultiplier <= 1 && r.NewPokemonIntervalMinutes == 0 {
+		return ErrEventNoBoost
+	}
+	return nil
+}
+
+func (s *Server) PostEvent(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	if !user.IsAdmin {
+		respondWithError(c, ErrAdminOnly)
+		return
+	}
+	var request PostEventRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid event",
+		})
+		return
+	}
+	if err := request.validate(); err != nil {
+		respondWithError(c, err)
+		return
+	}
+	event := models.Event{
+		Name:                      request.Name,
+		Description:               request.Description,
+		StartsAt:                  request.StartsAt,
+		EndsAt:                    request.EndsAt,
+		BoostedType:               request.BoostedType,
+		SpawnMultiplier:           request.SpawnMultiplier,
+		ShinyMultiplier:           request.ShinyMultiplier,
+		NewPokemonIntervalMinutes: request.NewPokemonIntervalMinutes,
+		CreatedByID:               user.ID,
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if len(request.BoostedPokemonIDs) > 0 {
+			if err := tx.Find(&event.BoostedPokemon, request.BoostedPokemonIDs).Error; err != nil {
+				return err
+			}
+			if len(event.BoostedPokemon) != len(request.BoostedPokemonIDs) {
+				return ErrEventBoostedPokemon
+			}
+		}
+		if request.BoostedType != "" {
+			err := tx.First(&models.Type{}, "name = ?", request.BoostedType).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrEventBoostedType
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Omit("BoostedPokemon.*").Create(&event).Error; err != nil {
+			return err
+		}
+		return s.Scheduler.Schedule(tx, AnnounceEventJob, event.ID, time.UnixMilli(event.StartsAt))
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, event)
+}
+
+type DeleteEventRequest struct {
+	EventID uint `json:"eventId"`
+}
+
+// DeleteEvent removes an event, which also ends it early if it is active
+func (s *Server) DeleteEvent(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	if !user.IsAdmin {
+		respondWithError(c, ErrAdminOnly)
+		return
+	}
+	var request DeleteEventRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid event id",
+		})
+		return
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var event models.Event
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&event, request.EventID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrEventNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Select("BoostedPokemon").Delete(&event).Error; err != nil {
+			return err
+		}
+		return s.Scheduler.Cancel(tx, AnnounceEventJob, event.ID)
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, "ok")
+}
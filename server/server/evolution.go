@@ -0,0 +1,318 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"susie.mx/gokemon/achievements"
+	"susie.mx/gokemon/models"
+	"susie.mx/gokemon/pokedex"
+)
+
+// StartingLevel and BaseFriendship must match the defaults of OwnedPokemon
+const StartingLevel = 5
+const BaseFriendship = 70
+
+// levelUpFriendship is how much friendship a pokemon gains when it levels up.
+// Like in the games, pokemon bond faster while they are still unfamiliar.
+func levelUpFriendship(friendship uint) uint {
+	switch {
+	case friendship < 100:
+		return 5
+	case friendship < 200:
+		return 3
+	default:
+		return 2
+	}
+}
+
+func gainFriendship(friendship uint, amount uint) uint {
+	if friendship+amount > MaxFriendship {
+		return MaxFriendship
+	}
+	return friendship + amount
+}
+
+var (
+	ErrOwnedPokemonNotFound = ApiError{http.StatusNotFound, "owned pokemon not found"}
+	ErrEvolvePokemon        = ApiError{http.StatusBadRequest, "can only evolve pokemon you own"}
+	ErrCannotEvolve         = ApiError{http.StatusBadRequest, "pokemon can not evolve"}
+	ErrAmbiguousEvolution   = ApiError{http.StatusBadRequest, "pokemon can evolve into several pokemon, choose one"}
+)
+
+// evolutionBlocker explains why the pokemon can not evolve by leveling up in
+// the given way right now, or returns "" if it can. localTime is in the
+// owner's time zone.
+func evolutionBlocker(evolution models.Evolution, pokemon models.OwnedPokemon, localTime time.Time) string {
+	switch evolution.Trigger {
+	case models.EvolutionTriggerLevelUp:
+	case models.EvolutionTriggerTrade:
+		return "evolves when traded"
+	case models.EvolutionTriggerUseItem:
+		return fmt.Sprintf("evolves with a %s, and items are not supported yet", evolution.Item)
+	default:
+		return fmt.Sprintf("evolves by %s, which is not supported yet", evolution.Trigger)
+	}
+	if evolution.HasOtherRequirements {
+		return "has evolution requirements that are not supported yet"
+	}
+	if evolution.Gender != nil && pokemon.Gender != *evolution.Gender {
+		if *evolution.Gender == models.GenderFemale {
+			return "must be female"
+		}
+		return "must be male"
+	}
+	if evolution.HeldItem != "" {
+		return fmt.Sprintf("must hold a %s, and items are not supported yet", evolution.HeldItem)
+	}
+	if evolution.MinLevel != nil && pokemon.Level < *evolution.MinLevel {
+		return fmt.Sprintf("must be at least level %d", *evolution.MinLevel)
+	}
+	if evolution.MinHappiness != nil && pokemon.Friendship < *evolution.MinHappiness {
+		return "must be friendlier with its trainer"
+	}
+	if evolution.TimeOfDay != "" && evolution.TimeOfDay != timeOfDay(localTime) {
+		return fmt.Sprintf("can only evolve at %s", evolution.TimeOfDay)
+	}
+	return ""
+}
+
+func timeOfDay(t time.Time) string {
+	switch hour := t.Hour(); {
+	case hour >= 17 && hour < 18:
+		return "dusk"
+	case hour >= 6 && hour < 18:
+		return "day"
+	default:
+		return "night"
+	}
+}
+
+// evolvePokemon turns the pokemon into another species, keeping its form if
+// the new species has it. Everything else about the pokemon, like being shiny
+// or who caught it, stays the same.
+func evolvePokemon(tx *gorm.DB, pokemon *models.OwnedPokemon, to models.Pokemon, now int64) (models.EvolutionRecord, error) {
+	record := models.EvolutionRecord{
+		OwnedPokemonID: pokemon.ID,
+		FromPokemonID:  pokemon.PokemonID,
+		FromFormIndex:  pokemon.FormIndex,
+		ToPokemonID:    to.ID,
+		EvolvedAt:      now,
+	}
+	if int(pokemon.FormIndex) < len(to.Forms) {
+		record.ToFormIndex = pokemon.FormIndex
+	}
+	ability, err := evolvedAbility(tx, *pokemon, record.ToPokemonID, record.ToFormIndex)
+	if err != nil {
+		return models.EvolutionRecord{}, err
+	}
+	err = tx.Model(pokemon).Updates(map[string]interface{}{
+		"pokemon_id": record.ToPokemonID,
+		"form_index": record.ToFormIndex,
+		"ability":    ability,
+	}).Error
+	if err != nil {
+		return models.EvolutionRecord{}, err
+	}
+	pokemon.PokemonID = record.ToPokemonID
+	pokemon.FormIndex = record.ToFormIndex
+	pokemon.Ability = ability
+	pokemon.Pokemon = to
+	// Whatever was offered for it no longer describes it
+	if err := invalidateClaims(tx, []uint{pokemon.ID}); err != nil {
+		return models.EvolutionRecord{}, err
+	}
+	if pokemon.OwnerID != nil {
+		if err := pokedex.RecordCaught(tx, *pokemon.OwnerID, *pokemon, now); err != nil {
+			return models.EvolutionRecord{}, err
+		}
+	}
+	err = tx.Create(&record).Error
+	return record, err
+}
+
+// evolvedAbility is the ability the pokemon has after evolving, which is the
+// one in the same slot as its current ability like in the games
+func evolvedAbility(tx *gorm.DB, pokemon models.OwnedPokemon, toPokemonID uint, toFormIndex uint) (string, error) {
+	if pokemon.Ability == "" {
+		return "", nil
+	}
+	var from, to models.Pokemon
+	if err := tx.Preload("Forms.Abilities").Preload("Forms").First(&from, pokemon.PokemonID).Error; err != nil {
+		return "", err
+	}
+	if err := tx.Preload("Forms.Abilities").Preload("Forms").First(&to, toPokemonID).Error; err != nil {
+		return "", err
+	}
+	if int(pokemon.FormIndex) >= len(from.Forms) || int(toFormIndex) >= len(to.Forms) {
+		return pokemon.Ability, nil
+	}
+	var slot uint
+	for _, ability := range from.Forms[pokemon.FormIndex].Abilities {
+		if ability.Name == pokemon.Ability {
+			slot = ability.Slot
+		}
+	}
+	abilities := to.Forms[toFormIndex].Abilities
+	for _, ability := range abilities {
+		if ability.Slot == slot {
+			return ability.Name, nil
+		}
+	}
+	// The evolution has fewer regular abilities, so fall back to its first one
+	for _, ability := range abilities {
+		if !ability.IsHidden {
+			return ability.Name, nil
+		}
+	}
+	return pokemon.Ability, nil
+}
+
+// tradeEvolutionApplies reports whether a pokemon evolves in the given way when
+// traded for tradedFor
+func tradeEvolutionApplies(evolution models.Evolution, tradedFor []models.OwnedPokemon) bool {
+	if evolution.Trigger != models.EvolutionTriggerTrade {
+		return false
+	}
+	// Pokemon that must hold an item to evolve never do, since there are no
+	// items yet
+	if evolution.HeldItem != "" || evolution.HasOtherRequirements || evolution.Gender != nil {
+		return false
+	}
+	if evolution.TradeSpeciesID == nil {
+		return true
+	}
+	for _, p := range tradedFor {
+		if p.PokemonID == *evolution.TradeSpeciesID {
+			return true
+		}
+	}
+	return false
+}
+
+// applyTradeEvolutions evolves the pokemon that were just traded for tradedFor
+// and evolve by being traded. It returns a record for each evolution.
+// tradedFor must not be the other side of the trade after it evolved.
+func applyTradeEvolutions(tx *gorm.DB, traded []models.OwnedPokemon, tradedFor []models.OwnedPokemon, now int64) ([]models.EvolutionRecord, error) {
+	records := []models.EvolutionRecord{}
+	for i := range traded {
+		var evolutions []models.Evolution
+		err := tx.Where("from_pokemon_id = ? AND trigger = ?", traded[i].PokemonID, models.EvolutionTriggerTrade).
+			Order("id").
+			Find(&evolutions).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, evolution := range evolutions {
+			if !tradeEvolutionApplies(evolution, tradedFor) {
+				continue
+			}
+			var to models.Pokemon
+			if err := tx.Preload("Forms").First(&to, evolution.ToPokemonID).Error; err != nil {
+				return nil, err
+			}
+			record, err := evolvePokemon(tx, &traded[i], to, now)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+			break
+		}
+	}
+	return records, nil
+}
+
+type EvolvePokemonRequest struct {
+	// Only needed when the pokemon can evolve into several species
+	ToPokemonID uint `json:"toPokemonId"`
+}
+
+func (s *Server) EvolvePokemon(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
+		})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid owned pokemon id",
+		})
+		return
+	}
+	var request EvolvePokemonRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid evolution",
+		})
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+
+	var pokemon models.OwnedPokemon
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pokemon, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrOwnedPokemonNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !isOwnedBy(pokemon, user.ID) {
+			return ErrEvolvePokemon
+		}
+		query := tx.Where("from_pokemon_id = ?", pokemon.PokemonID)
+		if request.ToPokemonID != 0 {
+			query = query.Where("to_pokemon_id = ?", request.ToPokemonID)
+		}
+		var evolutions []models.Evolution
+		if err := query.Order("id").Find(&evolutions).Error; err != nil {
+			return err
+		}
+		if len(evolutions) == 0 {
+			return ErrCannotEvolve
+		}
+		var possible []models.Evolution
+		blocker := ""
+		for _, evolution := range evolutions {
+			if b := evolutionBlocker(evolution, pokemon, userTime(user, time.Now())); b != "" {
+				if blocker == "" {
+					blocker = b
+				}
+				continue
+			}
+			if len(possible) > 0 && possible[0].ToPokemonID != evolution.ToPokemonID {
+				return ErrAmbiguousEvolution
+			}
+			possible = append(possible, evolution)
+		}
+		if len(possible) == 0 {
+			return ApiError{http.StatusBadRequest, "pokemon " + blocker}
+		}
+		var to models.Pokemon
+		err = tx.Preload("Forms.Sprites").Preload("Forms.Types").Preload("Forms").First(&to, possible[0].ToPokemonID).Error
+		if err != nil {
+			return err
+		}
+		_, err = evolvePokemon(tx, &pokemon, to, time.Now().UnixMilli())
+		return err
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	s.awardAchievements(achievements.PokemonEvolved, user.ID)
+	c.JSON(http.StatusOK, pokemon)
+}
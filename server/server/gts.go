@@ -0,0 +1,364 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"susie.mx/gokemon/achievements"
+	"susie.mx/gokemon/models"
+)
+
+const DefaultTradeListingPageSize = 20
+const MaxTradeListingPageSize = 100
+
+var (
+	ErrTradeListingNotFound   = ApiError{http.StatusNotFound, "trade listing not found"}
+	ErrTradeListingClosed     = ApiError{http.StatusConflict, "trade listing is no longer open"}
+	ErrTradeListingOwn        = ApiError{http.StatusBadRequest, "can not trade with own listing"}
+	ErrTradeListingNoCriteria = ApiError{http.StatusBadRequest, "a listing must want something in return"}
+	ErrTradeListingDuplicate  = ApiError{http.StatusBadRequest, "pokemon is already listed"}
+	ErrTradeListingPokemon    = ApiError{http.StatusBadRequest, "can only list pokemon you own"}
+	ErrTradeListingNoMatch    = ApiError{http.StatusBadRequest, "offered pokemon does not match what the listing wants"}
+	ErrWantedPokemonNotFound  = ApiError{http.StatusBadRequest, "wanted pokemon does not exist"}
+	ErrTradeListingFavorite   = ApiError{http.StatusBadRequest, "favorite pokemon can not be listed"}
+)
+
+func (s *Server) GetTradeListings(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid page",
+		})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(DefaultTradeListingPageSize)))
+	if err != nil || pageSize < 1 || pageSize > MaxTradeListingPageSize {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid page size",
+		})
+		return
+	}
+
+	query := s.DB.Model(&models.TradeListing{}).
+		Joins("JOIN owned_pokemons ON owned_pokemons.id = trade_listings.owned_pokemon_id").
+		Joins("JOIN pokemons ON pokemons.id = owned_pokemons.pokemon_id").
+		Where("trade_listings.status = ?", models.TradeListingOpen)
+	if pokemonID := c.Query("pokemonId"); pokemonID != "" {
+		query = query.Where("owned_pokemons.pokemon_id = ?", pokemonID)
+	}
+	if formIndex := c.Query("formIndex"); formIndex != "" {
+		query = query.Where("owned_pokemons.form_index = ?", formIndex)
+	}
+	if isShiny := c.Query("isShiny"); isShiny != "" {
+		query = query.Where("owned_pokemons.is_shiny = ?", isShiny == "true")
+	}
+	if isLegendary := c.Query("isLegendary"); isLegendary != "" {
+		query = query.Where("pokemons.is_legendary = ?", isLegendary == "true")
+	}
+	if wantedPokemonID := c.Query("wantedPokemonId"); wantedPokemonID != "" {
+		query = query.Where("trade_listings.wanted_pokemon_id = ?", wantedPokemonID)
+	}
+	if username := c.Query("username"); username != "" {
+		query = query.Where("trade_listings.user_id = (?)", s.DB.Model(&models.User{}).Select("id").Where("username = ?", username))
+	}
+
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		respondWithError(c, err)
+		return
+	}
+	listings := []models.TradeListing{}
+	err = query.Preload("User").
+		Preload("OwnedPokemon.Pokemon.Forms.Sprites").
+		Preload("OwnedPokemon.Pokemon.Forms.Types").
+		Preload("OwnedPokemon.Pokemon.Forms").
+		Preload("OwnedPokemon.Pokemon").
+		Preload("OwnedPokemon").
+		Preload("WantedPokemon.Forms.Sprites").
+		Preload("WantedPokemon.Forms").
+		Preload("WantedPokemon").
+		Order("trade_listings.created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&listings).Error
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"listings": listings,
+		"total":    total,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+type PostTradeListingRequest struct {
+	OwnedPokemonID    uint  `json:"ownedPokemonId"`
+	WantedPokemonID   *uint `json:"wantedPokemonId"`
+	WantedFormIndex   *uint `json:"wantedFormIndex"`
+	WantedIsShiny     *bool `json:"wantedIsShiny"`
+	WantedIsLegendary *bool `json:"wantedIsLegendary"`
+}
+
+func (s *Server) PostTradeListing(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
+		})
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	var request PostTradeListingRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid trade listing",
+		})
+		return
+	}
+	if request.WantedPokemonID == nil && request.WantedIsShiny == nil && request.WantedIsLegendary == nil {
+		respondWithError(c, ErrTradeListingNoCriteria)
+		return
+	}
+	var listing models.TradeListing
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var pokemon models.OwnedPokemon
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pokemon, request.OwnedPokemonID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !isOwnedBy(pokemon, user.ID)) {
+			return ErrTradeListingPokemon
+		}
+		if err != nil {
+			return err
+		}
+		if pokemon.IsFavorite {
+			return ErrTradeListingFavorite
+		}
+		if request.WantedPokemonID != nil {
+			var wanted models.Pokemon
+			err := tx.Preload("Forms").First(&wanted, *request.WantedPokemonID).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrWantedPokemonNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if request.WantedFormIndex != nil && int(*request.WantedFormIndex) >= len(wanted.Forms) {
+				return ErrWantedPokemonNotFound
+			}
+		}
+		var numListings int64
+		err = tx.Model(&models.TradeListing{}).
+			Where("owned_pokemon_id = ? AND status = ?", pokemon.ID, models.TradeListingOpen).
+			Count(&numListings).Error
+		if err != nil {
+			return err
+		}
+		if numListings > 0 {
+			return ErrTradeListingDuplicate
+		}
+		listing = models.TradeListing{
+			Status:            models.TradeListingOpen,
+			UserID:            user.ID,
+			OwnedPokemonID:    pokemon.ID,
+			WantedPokemonID:   request.WantedPokemonID,
+			WantedIsShiny:     request.WantedIsShiny,
+			WantedIsLegendary: request.WantedIsLegendary,
+		}
+		// A form only makes sense for a specific species
+		if request.WantedPokemonID != nil {
+			listing.WantedFormIndex = request.WantedFormIndex
+		}
+		return tx.Create(&listing).Error
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, listing)
+}
+
+type DeleteTradeListingRequest struct {
+	TradeListingID uint `json:"tradeListingId"`
+}
+
+func (s *Server) DeleteTradeListing(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	var request DeleteTradeListingRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid trade listing",
+		})
+		return
+	}
+	result := s.DB.Model(&models.TradeListing{}).
+		Where("id = ? AND user_id = ? AND status = ?", request.TradeListingID, user.ID, models.TradeListingOpen).
+		Updates(map[string]interface{}{
+			"status":    models.TradeListingWithdrawn,
+			"closed_at": time.Now().UnixMilli(),
+		})
+	if result.Error != nil {
+		respondWithError(c, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		respondWithError(c, ErrTradeListingNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, "ok")
+}
+
+type OfferTradeListingRequest struct {
+	TradeListingID uint `json:"tradeListingId"`
+	OwnedPokemonID uint `json:"ownedPokemonId"`
+}
+
+func (s *Server) OfferTradeListing(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
+		})
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	var request OfferTradeListingRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid trade offer",
+		})
+		return
+	}
+	var trade models.Trade
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		trade, err = executeTradeListing(tx, request.TradeListingID, user.ID, request.OwnedPokemonID)
+		return err
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	s.awardAchievements(achievements.TradeCompleted, trade.UserID, trade.FriendID)
+	c.JSON(http.StatusOK, trade)
+}
+
+// executeTradeListing trades the pokemon of a listing for a matching pokemon
+// offered by userID. Like executeTrade it must be run inside a transaction.
+func executeTradeListing(tx *gorm.DB, listingID uint, userID uint, offeredPokemonID uint) (models.Trade, error) {
+	var listing models.TradeListing
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&listing, listingID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Trade{}, ErrTradeListingNotFound
+	}
+	if err != nil {
+		return models.Trade{}, err
+	}
+	if listing.Status != models.TradeListingOpen {
+		return models.Trade{}, ErrTradeListingClosed
+	}
+	if listing.UserID == userID {
+		return models.Trade{}, ErrTradeListingOwn
+	}
+
+	// Lock in id order so that trades sharing a pokemon can not deadlock
+	var pokemon []models.OwnedPokemon
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Pokemon").
+		Order("id").
+		Find(&pokemon, []uint{listing.OwnedPokemonID, offeredPokemonID}).Error
+	if err != nil {
+		return models.Trade{}, err
+	}
+	if len(pokemon) != 2 {
+		return models.Trade{}, ErrTradePokemonMissing
+	}
+	var listedPokemon, offeredPokemon models.OwnedPokemon
+	for _, p := range pokemon {
+		if p.ID == listing.OwnedPokemonID {
+			listedPokemon = p
+		} else {
+			offeredPokemon = p
+		}
+	}
+	if !isOwnedBy(listedPokemon, listing.UserID) || !isOwnedBy(offeredPokemon, userID) {
+		return models.Trade{}, ErrTradePokemonNotOwned
+	}
+	if !listingAccepts(listing, offeredPokemon) {
+		return models.Trade{}, ErrTradeListingNoMatch
+	}
+
+	now := time.Now().UnixMilli()
+	trade := models.Trade{
+		TradeListingID: &listing.ID,
+		UserID:         listing.UserID,
+		UserPokemon:    []models.OwnedPokemon{listedPokemon},
+		FriendID:       userID,
+		FriendPokemon:  []models.OwnedPokemon{offeredPokemon},
+		RequestedAt:    listing.CreatedAt,
+		CompletedAt:    now,
+	}
+	if err := tx.Omit("UserPokemon.*", "FriendPokemon.*").Create(&trade).Error; err != nil {
+		return models.Trade{}, err
+	}
+	err = tx.Model(&listing).Updates(map[string]interface{}{
+		"status":    models.TradeListingCompleted,
+		"trade_id":  trade.ID,
+		"closed_at": now,
+	}).Error
+	if err != nil {
+		return models.Trade{}, err
+	}
+	if err := transferPokemon(tx, &listedPokemon, userID, trade.ID, now); err != nil {
+		return models.Trade{}, err
+	}
+	if err := transferPokemon(tx, &offeredPokemon, listing.UserID, trade.ID, now); err != nil {
+		return models.Trade{}, err
+	}
+	return trade, nil
+}
+
+func listingAccepts(listing models.TradeListing, offered models.OwnedPokemon) bool {
+	if listing.WantedPokemonID != nil && *listing.WantedPokemonID != offered.PokemonID {
+		return false
+	}
+	if listing.WantedFormIndex != nil && *listing.WantedFormIndex != offered.FormIndex {
+		return false
+	}
+	if listing.WantedIsShiny != nil && *listing.WantedIsShiny != offered.IsShiny {
+		return false
+	}
+	if listing.WantedIsLegendary != nil && *listing.WantedIsLegendary != offered.Pokemon.IsLegendary {
+		return false
+	}
+	return true
+}
+
+// invalidateTradeListings closes the open listings of pokemon that have
+// changed hands outside of the listing.
+func invalidateTradeListings(tx *gorm.DB, ownedPokemonIDs []uint) error {
+	return tx.Model(&models.TradeListing{}).
+		Where("status = ? AND owned_pokemon_id IN ?", models.TradeListingOpen, ownedPokemonIDs).
+		Updates(map[string]interface{}{
+			"status":    models.TradeListingInvalidated,
+			"closed_at": time.Now().UnixMilli(),
+		}).Error
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"susie.mx/gokemon/models"
+)
+
+// unscoped is a preload condition that includes released pokemon, which past
+// trades still refer to
+func unscoped(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
+
+func (s *Server) GetTradeHistory(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	trades := []models.Trade{}
+	err := s.DB.Preload("User").
+		Preload("UserPokemon.Pokemon.Forms.Sprites").
+		Preload("UserPokemon.Pokemon.Forms.Types").
+		Preload("UserPokemon.Pokemon.Forms").
+		Preload("UserPokemon.Pokemon").
+		Preload("UserPokemon", unscoped).
+		Preload("Friend").
+		Preload("FriendPokemon.Pokemon.Forms.Sprites").
+		Preload("FriendPokemon.Pokemon.Forms.Types").
+		Preload("FriendPokemon.Pokemon.Forms").
+		Preload("FriendPokemon.Pokemon").
+		Preload("FriendPokemon", unscoped).
+		Order("completed_at DESC").
+		Find(&trades, "user_id = ? OR friend_id = ?", user.ID, user.ID).Error
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, trades)
+}
+
+func (s *Server) GetOwnedPokemonHistory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid owned pokemon id",
+		})
+		return
+	}
+	var pokemon models.OwnedPokemon
+	err = s.DB.Unscoped().
+		Preload("Pokemon.Forms.Sprites").
+		Preload("Pokemon.Forms.Types").
+		Preload("Pokemon.Forms").
+		Preload("Pokemon").
+		Preload("CaughtBy").
+		First(&pokemon, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		respondWithError(c, ErrOwnedPokemonNotFound)
+		return
+	}
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	owners := []models.OwnershipRecord{}
+	err = s.DB.Preload("Owner").
+		Order("acquired_at").
+		Find(&owners, "owned_pokemon_id = ?", pokemon.ID).Error
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	evolutions := []models.EvolutionRecord{}
+	err = s.DB.Order("evolved_at").Find(&evolutions, "owned_pokemon_id = ?", pokemon.ID).Error
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"pokemon":    pokemon,
+		"owners":     owners,
+		"evolutions": evolutions,
+	})
+}
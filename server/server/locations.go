@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"susie.mx/gokemon/encounter"
+	"susie.mx/gokemon/models"
+)
+
+var ErrUnknownLocation = ApiError{http.StatusBadRequest, "unknown location"}
+
+func (s *Server) GetLocations(c *gin.Context) {
+	c.JSON(http.StatusOK, encounter.Locations)
+}
+
+type UpdateLocationRequest struct {
+	// An empty location draws from every pokemon equally
+	Location string `json:"location"`
+}
+
+func (s *Server) UpdateLocation(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var request UpdateLocationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid location",
+		})
+		return
+	}
+	if _, ok := encounter.FindLocation(request.Location); request.Location != "" && !ok {
+		respondWithError(c, ErrUnknownLocation)
+		return
+	}
+	err := s.DB.Model(&models.User{}).
+		Where("username = ?", username).
+		Update("location", request.Location).Error
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, "ok")
+}
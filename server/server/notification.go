@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"susie.mx/gokemon/models"
+)
+
+const MaxNotifications = 50
+
+func notify(tx *gorm.DB, userID uint, message string) error {
+	return tx.Create(&models.Notification{
+		UserID:  userID,
+		Message: message,
+	}).Error
+}
+
+func (s *Server) GetNotifications(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	notifications := []models.Notification{}
+	err := s.DB.Order("created_at DESC").
+		Limit(MaxNotifications).
+		Find(&notifications, "user_id = ?", user.ID).Error
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, notifications)
+}
+
+type ReadNotificationsRequest struct {
+	NotificationIDs []uint `json:"notificationIds"`
+}
+
+func (s *Server) ReadNotifications(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	var request ReadNotificationsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid notification ids",
+		})
+		return
+	}
+	if len(request.NotificationIDs) > 0 {
+		err := s.DB.Model(&models.Notification{}).
+			Where("user_id = ? AND id IN ?", user.ID, request.NotificationIDs).
+			Update("is_read", true).Error
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, "ok")
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+	"susie.mx/gokemon/models"
+)
+
+const MaxNicknameLength = 12
+const MaxNoteLength = 200
+
+var (
+	ErrUpdateOwnedPokemon = ApiError{http.StatusBadRequest, "can only change pokemon you own"}
+	ErrNicknameTooLong    = ApiError{http.StatusBadRequest, "nickname is too long"}
+	ErrNoteTooLong        = ApiError{http.StatusBadRequest, "note is too long"}
+	ErrInvalidText        = ApiError{http.StatusBadRequest, "text contains characters that are not allowed"}
+	ErrProfanity          = ApiError{http.StatusBadRequest, "text contains words that are not allowed"}
+)
+
+// A ProfanityFilter reports whether text contains words that should not be
+// shown to other users
+type ProfanityFilter func(text string) bool
+
+// normalizeText trims and NFC normalizes text a user entered, so that the same
+// visible text is always stored the same way, and checks its length in
+// characters
+func (s *Server) normalizeText(text string, maxLength int, tooLong error) (string, error) {
+	text = strings.TrimSpace(norm.NFC.String(text))
+	if !utf8.ValidString(text) {
+		return "", ErrInvalidText
+	}
+	// Format characters like bidi overrides and zero width joiners are invisible
+	// and could make the text look like something else to other users
+	for _, r := range text {
+		if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) {
+			return "", ErrInvalidText
+		}
+	}
+	if utf8.RuneCountInString(text) > maxLength {
+		return "", tooLong
+	}
+	if s.ProfanityFilter != nil && s.ProfanityFilter(text) {
+		return "", ErrProfanity
+	}
+	return text, nil
+}
+
+// Fields that are left out are not changed. An empty nickname or note clears
+// it.
+type UpdateOwnedPokemonRequest struct {
+	Nickname   *string `json:"nickname"`
+	IsFavorite *bool   `json:"isFavorite"`
+	Note       *string `json:"note"`
+}
+
+type OwnedPokemonNote struct {
+	OwnedPokemonID uint   `json:"ownedPokemonId"`
+	Note           string `json:"note"`
+}
+
+// GetOwnedPokemonNotes returns the notes on the logged in user's pokemon. Notes
+// are left out of every other response, since pokemon are shown to other users
+// in many places.
+func (s *Server) GetOwnedPokemonNotes(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	notes := []OwnedPokemonNote{}
+	err := s.DB.Model(&models.OwnedPokemon{}).
+		Select("id AS owned_pokemon_id, note").
+		Where("owner_id = ? AND note <> ''", user.ID).
+		Order("id").
+		Scan(&notes).Error
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, notes)
+}
+
+func (s *Server) UpdateOwnedPokemon(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
+		})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid owned pokemon id",
+		})
+		return
+	}
+	var request UpdateOwnedPokemonRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid owned pokemon update",
+		})
+		return
+	}
+	updates := map[string]interface{}{}
+	if request.Nickname != nil {
+		nickname, err := s.normalizeText(*request.Nickname, MaxNicknameLength, ErrNicknameTooLong)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+		updates["nickname"] = nickname
+	}
+	if request.Note != nil {
+		note, err := s.normalizeText(*request.Note, MaxNoteLength, ErrNoteTooLong)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+		updates["note"] = note
+	}
+	if request.IsFavorite != nil {
+		updates["is_favorite"] = *request.IsFavorite
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+
+	var pokemon models.OwnedPokemon
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		pokemon, err = lockOwnedPokemon(tx, id, user.ID, ErrUpdateOwnedPokemon)
+		if err != nil {
+			return err
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&pokemon).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		// Favorites are kept out of the public trade pools
+		if pokemon.IsFavorite {
+			if err := invalidateTradeListings(tx, []uint{pokemon.ID}); err != nil {
+				return err
+			}
+			return withdrawWonderTradeDeposits(tx, []uint{pokemon.ID})
+		}
+		return nil
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pokemon)
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"gorm.io/gorm"
+	"susie.mx/gokemon/models"
+	"susie.mx/gokemon/pokedex"
+)
+
+func recordCatch(tx *gorm.DB, pokemon *models.OwnedPokemon, userID uint, now int64) error {
+	err := tx.Model(pokemon).Updates(map[string]interface{}{
+		"caught_by_id": userID,
+		"caught_at":    now,
+	}).Error
+	if err != nil {
+		return err
+	}
+	if err := pokedex.RecordCaught(tx, userID, *pokemon, now); err != nil {
+		return err
+	}
+	return tx.Create(&models.OwnershipRecord{
+		OwnedPokemonID: pokemon.ID,
+		OwnerID:        userID,
+		Method:         models.AcquiredByCatching,
+		AcquiredAt:     now,
+	}).Error
+}
+
+func transferPokemon(tx *gorm.DB, pokemon *models.OwnedPokemon, toUserID uint, tradeID uint, now int64) error {
+	// Like in the games, a pokemon has to bond with its new trainer again. It
+	// keeps its nickname, but the note and favorite flag were its old owner's.
+	err := tx.Model(pokemon).Updates(map[string]interface{}{
+		"owner_id":    toUserID,
+		"friendship":  BaseFriendship,
+		"note":        "",
+		"is_favorite": false,
+	}).Error
+	if err != nil {
+		return err
+	}
+	if err := invalidateClaims(tx, []uint{pokemon.ID}); err != nil {
+		return err
+	}
+	if err := removeFromTeams(tx, []uint{pokemon.ID}); err != nil {
+		return err
+	}
+	if err := pokedex.RecordCaught(tx, toUserID, *pokemon, now); err != nil {
+		return err
+	}
+	return tx.Create(&models.OwnershipRecord{
+		OwnedPokemonID: pokemon.ID,
+		OwnerID:        toUserID,
+		Method:         models.AcquiredByTrade,
+		TradeID:        &tradeID,
+		AcquiredAt:     now,
+	}).Error
+}
+
+// invalidateClaims closes everything that relies on the given pokemon staying
+// with their current owner.
+func invalidateClaims(tx *gorm.DB, ownedPokemonIDs []uint) error {
+	if err := invalidateTradeRequests(tx, ownedPokemonIDs); err != nil {
+		return err
+	}
+	if err := invalidateTradeListings(tx, ownedPokemonIDs); err != nil {
+		return err
+	}
+	return withdrawWonderTradeDeposits(tx, ownedPokemonIDs)
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"susie.mx/gokemon/events"
+	"susie.mx/gokemon/models"
+)
+
+const MaxRerollsPerDay = 3
+const MaxHeldPokemon = 1
+
+var (
+	ErrNoPendingPokemon = ApiError{http.StatusConflict, "there are no pending pokemon"}
+	ErrNoRerollsLeft    = ApiError{http.StatusTooManyRequests, "no rerolls left today"}
+	ErrNoEncounters     = ApiError{http.StatusServiceUnavailable, "no pokemon can be encountered right now"}
+	ErrHoldFull         = ApiError{http.StatusConflict, "already holding as many pokemon as possible"}
+	ErrHoldPokemon      = ApiError{http.StatusBadRequest, "can only hold your pending pokemon"}
+	ErrNoHeldPokemon    = ApiError{http.StatusNotFound, "not holding any pokemon"}
+	ErrUserNotFound     = ApiError{http.StatusNotFound, "user not found"}
+)
+
+// lockUser locks the user row the same way pending pokemon deliveries do, so
+// that a batch can not be delivered while it is being changed
+func lockUser(tx *gorm.DB, username interface{}) (models.User, error) {
+	var user models.User
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "username = ?", username).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, ErrUserNotFound
+	}
+	return user, err
+}
+
+// discardPendingPokemon deletes the user's pending pokemon, which have never
+// been owned and so need no history
+func discardPendingPokemon(tx *gorm.DB, userID uint) error {
+	result := tx.Unscoped().Delete(&models.OwnedPokemon{}, "pending_owner_id = ?", userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNoPendingPokemon
+	}
+	return nil
+}
+
+func preloadPendingPokemon(db *gorm.DB, userID uint) ([]models.OwnedPokemon, error) {
+	pokemon := []models.OwnedPokemon{}
+	err := db.
+		Preload("Pokemon.Forms.Sprites").
+		Preload("Pokemon.Forms.Types").
+		Preload("Pokemon.Forms").
+		Preload("Pokemon").
+		Order("id").
+		Find(&pokemon, "pending_owner_id = ?", userID).Error
+	return pokemon, err
+}
+
+// RerollPendingPokemon replaces the current batch of pending pokemon with a new
+// one, a limited number of times per day
+func (s *Server) RerollPendingPokemon(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
+		})
+		return
+	}
+	var user models.User
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = lockUser(tx, username)
+		if err != nil {
+			return err
+		}
+		today := userTime(user, time.Now()).Format("2006-01-02")
+		if user.RerollDay != today {
+			user.RerollDay = today
+			user.RerollCount = 0
+		}
+		if user.RerollCount >= MaxRerollsPerDay {
+			return ErrNoRerollsLeft
+		}
+		if err := discardPendingPokemon(tx, user.ID); err != nil {
+			return err
+		}
+		if err := s.createPendingBatch(tx, user); err != nil {
+			return err
+		}
+		user.RerollCount++
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"reroll_day":   user.RerollDay,
+			"reroll_count": user.RerollCount,
+		}).Error
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	pendingPokemon, err := preloadPendingPokemon(s.DB, user.ID)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"pendingPokemon": pendingPokemon,
+		"rerollsLeft":    MaxRerollsPerDay - user.RerollCount,
+	})
+}
+
+// SkipPendingPokemon discards the current batch of pending pokemon and starts
+// waiting for the next one
+func (s *Server) SkipPendingPokemon(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
+		})
+		return
+	}
+	var user models.User
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = lockUser(tx, username)
+		if err != nil {
+			return err
+		}
+		if err := discardPendingPokemon(tx, user.ID); err != nil {
+			return err
+		}
+		activeEvents, err := events.Active(tx, time.Now())
+		if err != nil {
+			return err
+		}
+		interval := events.NewPokemonInterval(NewPokemonInterval, activeEvents)
+		user.NextPokemonSelectionTimestamp = time.Now().Add(interval).UnixMilli()
+		err = tx.Model(&user).Update("next_pokemon_selection_timestamp", user.NextPokemonSelectionTimestamp).Error
+		if err != nil {
+			return err
+		}
+		return s.ScheduleNewPokemon(tx, user)
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"nextPokemonSelectionTimestamp": user.NextPokemonSelectionTimestamp,
+	})
+}
+
+type HoldPendingPokemonRequest struct {
+	PendingPokemonID uint `json:"pendingPokemonId"`
+}
+
+// HoldPendingPokemon keeps one of the pending pokemon aside, so that it is
+// offered again with the next batch instead of being discarded
+func (s *Server) HoldPendingPokemon(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
+		})
+		return
+	}
+	var request HoldPendingPokemonRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid pending pokemon id",
+		})
+		return
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := lockUser(tx, username)
+		if err != nil {
+			return err
+		}
+		var numHeld int64
+		if err := tx.Model(&models.OwnedPokemon{}).Where("held_owner_id = ?", user.ID).Count(&numHeld).Error; err != nil {
+			return err
+		}
+		if numHeld >= MaxHeldPokemon {
+			return ErrHoldFull
+		}
+		result := tx.Model(&models.OwnedPokemon{}).
+			Where("id = ? AND pending_owner_id = ?", request.PendingPokemonID, user.ID).
+			Updates(map[string]interface{}{
+				"pending_owner_id": nil,
+				"held_owner_id":    user.ID,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrHoldPokemon
+		}
+		return nil
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, "ok")
+}
+
+func (s *Server) DeleteHeldPokemon(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := lockUser(tx, username)
+		if err != nil {
+			return err
+		}
+		result := tx.Unscoped().Delete(&models.OwnedPokemon{}, "held_owner_id = ?", user.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNoHeldPokemon
+		}
+		return nil
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, "ok")
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"susie.mx/gokemon/models"
+	"susie.mx/gokemon/pokedex"
+)
+
+func (s *Server) GetPokedex(c *gin.Context) {
+	var user models.User
+	err := s.DB.First(&user, "username = ?", c.Param("username")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "user not found",
+		})
+		return
+	}
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	dex, err := pokedex.Get(s.DB, user.ID)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, dex)
+}
@@ -1,13 +1,21 @@
 package server
 
 import (
-	"math/rand"
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"susie.mx/gokemon/achievements"
+	"susie.mx/gokemon/encounter"
+	"susie.mx/gokemon/events"
 	"susie.mx/gokemon/models"
+	"susie.mx/gokemon/pokedex"
+	"susie.mx/gokemon/scheduler"
 )
 
 const NumMinutesBetweenNewPokemon = 25
@@ -17,65 +25,274 @@ const ShinyRateInGames = 1 / 8192.0
 const ShinyRate = NumMinutesBetweenNewPokemon * AverageEncounterRatePerMinuteInGames * ShinyRateInGames / NumPendingPokemon
 const NewPokemonInterval = NumMinutesBetweenNewPokemon * time.Minute
 
+// DefaultShinyPityBatches is roughly three times the expected number of
+// batches between shinies
+const DefaultShinyPityBatches = 500
+
+const DeliverPendingPokemonJob = "deliverPendingPokemon"
+
 func (s *Server) GetPokemons(c *gin.Context) {
 	var pokemon []models.Pokemon
-	s.DB.Preload("Forms").Preload("Forms.Types").Preload("Forms.Sprites").Find(&pokemon)
+	s.DB.Preload("Forms").Preload("Forms.Types").Preload("Forms.Sprites").Preload("Forms.Abilities").Find(&pokemon)
 	c.JSON(http.StatusOK, pokemon)
 }
 
-func (s *Server) GetRandomPokemon() models.Pokemon {
-	randomID := rand.Intn(models.MaxPokemonId-1) + 1
-	var pokemon models.Pokemon
-	s.DB.Preload("Forms").First(&pokemon, randomID)
-	return pokemon
+// ReloadEncounterTable rebuilds the encounter table from the pokemon in the
+// database and the encounter config, then swaps it in for new encounters.
+func (s *Server) ReloadEncounterTable() error {
+	config := encounter.DefaultConfig
+	if s.EncounterConfigPath != "" {
+		var err error
+		config, err = encounter.LoadConfig(s.EncounterConfigPath)
+		if err != nil {
+			return err
+		}
+	}
+	var pokemon []models.Pokemon
+	if err := s.DB.Preload("Forms.Types").Preload("Forms.Abilities").Preload("Forms").Find(&pokemon).Error; err != nil {
+		return err
+	}
+	table, err := encounter.NewTable(pokemon, config)
+	if err != nil {
+		return err
+	}
+	warnUnscrapedAttributes(pokemon)
+	s.Encounters.Swap(table)
+	return nil
+}
+
+// warnUnscrapedAttributes logs when pokemon are missing what is needed to roll
+// their gender and ability, which the scraper has to be run again to fill in
+func warnUnscrapedAttributes(pokemon []models.Pokemon) {
+	missingGenderRates, missingAbilities := 0, 0
+	for _, p := range pokemon {
+		if p.GenderRate == nil {
+			missingGenderRates++
+		}
+		for _, form := range p.Forms {
+			if len(form.Abilities) == 0 {
+				missingAbilities++
+				break
+			}
+		}
+	}
+	if missingGenderRates > 0 || missingAbilities > 0 {
+		log.Printf("%d pokemon have no gender rate and %d have forms without abilities, re-run the scraper to fill them in",
+			missingGenderRates, missingAbilities)
+	}
+}
+
+func (s *Server) ScheduleNewPokemon(db *gorm.DB, user models.User) error {
+	runAt := time.UnixMilli(user.NextPokemonSelectionTimestamp)
+	return s.Scheduler.Schedule(db, DeliverPendingPokemonJob, user.ID, runAt)
 }
 
-func (s *Server) NewPokemonTimer(userID uint) {
+func (s *Server) DeliverPendingPokemon(tx *gorm.DB, job models.Job) error {
 	var user models.User
-	s.DB.Preload("PendingPokemon").First(&user, userID)
-	nextTime := user.NextPokemonSelectionTimestamp
-	now := time.Now().UnixMilli()
-	duration := time.Duration(nextTime-now) * time.Millisecond
-	<-time.After(duration)
-	if len(user.PendingPokemon) > 0 {
-		return
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, job.SubjectID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
 	}
-	var ownedPokemons []models.OwnedPokemon
-	for i := 0; i < NumPendingPokemon; i++ {
-		p := s.GetRandomPokemon()
-		ownedPokemon := models.OwnedPokemon{
+	if err != nil {
+		return err
+	}
+	// Pending pokemon that have not been selected yet are never replaced
+	if tx.Model(&user).Association("PendingPokemon").Count() > 0 {
+		return nil
+	}
+	err = s.createPendingBatch(tx, user)
+	if errors.Is(err, ErrNoEncounters) {
+		// Check again once the encounter table may have been reloaded, rather
+		// than failing the job
+		return s.Scheduler.Schedule(tx, DeliverPendingPokemonJob, user.ID, time.Now().Add(scheduler.PollInterval))
+	}
+	if err != nil {
+		return err
+	}
+	// A held pokemon is offered again alongside the new batch
+	return tx.Model(&models.OwnedPokemon{}).
+		Where("held_owner_id = ?", user.ID).
+		Updates(map[string]interface{}{
+			"held_owner_id":    nil,
+			"pending_owner_id": user.ID,
+		}).Error
+}
+
+// createPendingBatch draws a new batch of pending pokemon for the user. The
+// user row must be locked by tx.
+func (s *Server) createPendingBatch(tx *gorm.DB, user models.User) error {
+	activeEvents, err := events.Active(tx, time.Now())
+	if err != nil {
+		return err
+	}
+	stats, err := lockEncounterStats(tx, user.ID)
+	if err != nil {
+		return err
+	}
+	modifiers := events.Modifiers(activeEvents)
+	shinyRate := events.ShinyRate(ShinyRate, activeEvents)
+	chainBonus := encounter.ChainBonusFor(stats.ChainLength)
+	if stats.ChainPokemonID != nil {
+		modifiers = append(modifiers, encounter.ChainModifier(*stats.ChainPokemonID, chainBonus))
+	}
+	if location, ok := encounter.FindLocation(user.Location); ok {
+		modifiers = append(modifiers, encounter.LocationModifier(location))
+	}
+	modifiers = append(modifiers, encounter.TimeModifiers(userTime(user, time.Now()))...)
+	// The table is missing until the pokemon have been scraped
+	table := s.Encounters.Table()
+	if table == nil || len(table.Entries()) == 0 {
+		return ErrNoEncounters
+	}
+	batch := make([]models.OwnedPokemon, NumPendingPokemon)
+	shinyRates := make([]float64, NumPendingPokemon)
+	for i := range batch {
+		p, formIndex := table.Pick(encounter.GlobalRand, modifiers...)
+		attributes := encounter.RollAttributes(encounter.GlobalRand, p, formIndex)
+		batch[i] = models.OwnedPokemon{
 			PendingOwnerID: &user.ID,
-			Pokemon:        p,
-			FormIndex:      uint(rand.Intn(len(p.Forms))),
-			IsShiny:        rand.Float64() <= ShinyRate,
+			PokemonID:      p.ID,
+			FormIndex:      formIndex,
+			Level:          attributes.Level,
+			Nature:         attributes.Nature,
+			IVs:            attributes.IVs,
+			Gender:         attributes.Gender,
+			Ability:        attributes.Ability,
+		}
+		shinyRates[i] = shinyRate
+		if stats.ChainPokemonID != nil && *stats.ChainPokemonID == p.ID {
+			shinyRates[i] *= chainBonus.ShinyMultiplier
+		}
+	}
+	pity := s.ShinyPityBatches > 0 && stats.BatchesSinceShiny+1 >= s.ShinyPityBatches
+	for i, isShiny := range encounter.RollShinies(encounter.GlobalRand, shinyRates, pity) {
+		batch[i].IsShiny = isShiny
+	}
+	for _, ownedPokemon := range batch {
+		if err := tx.Create(&ownedPokemon).Error; err != nil {
+			return err
+		}
+		if err := pokedex.RecordSeen(tx, user.ID, ownedPokemon, time.Now().UnixMilli()); err != nil {
+			return err
 		}
-		s.DB.Create(&ownedPokemon)
-		ownedPokemons = append(ownedPokemons, ownedPokemon)
 	}
-	s.DB.Model(&user).Association("PendingPokemon").Append(&ownedPokemons)
+	return recordBatch(tx, &stats, batch)
 }
 
 type SelectPokemonRequest struct {
 	PendingPokemonIndex uint `json:"pendingPokemonIndex"`
+	// Takes precedence over the index when given. Selecting the same pokemon
+	// again by id succeeds without doing anything, so retries are safe.
+	PendingPokemonID *uint `json:"pendingPokemonId"`
 }
 
+var (
+	ErrPendingPokemonIndex = ApiError{http.StatusBadRequest, "pending pokemon index out of range"}
+	ErrSelectPokemon       = ApiError{http.StatusBadRequest, "can only select your pending pokemon"}
+)
+
 func (s *Server) SelectPokemon(c *gin.Context) {
 	session := sessions.Default(c)
 	username := session.Get("username")
-	var user models.User
-	s.DB.Preload("PendingPokemon").First(&user, "username = ?", username)
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
+		})
+		return
+	}
 	var request SelectPokemonRequest
-	c.BindJSON(&request)
-	selectedPokemon := user.PendingPokemon[request.PendingPokemonIndex]
-	for i, p := range user.PendingPokemon {
-		s.DB.Model(&user).Association("PendingPokemon").Delete(&p)
-		if uint(i) != request.PendingPokemonIndex {
-			s.DB.Delete(&p)
-		}
-	}
-	s.DB.Model(&user).Association("OwnedPokemon").Append(&selectedPokemon)
-	user.NextPokemonSelectionTimestamp = time.Now().Add(NewPokemonInterval).UnixMilli()
-	s.DB.Save(&user)
-	go s.NewPokemonTimer(user.ID)
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid pending pokemon selection",
+		})
+		return
+	}
+	var user models.User
+	selected := false
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = lockUser(tx, username)
+		if err != nil {
+			return err
+		}
+		var pendingPokemon []models.OwnedPokemon
+		if err := tx.Order("id").Find(&pendingPokemon, "pending_owner_id = ?", user.ID).Error; err != nil {
+			return err
+		}
+		selectedPokemon, err := findSelectedPokemon(tx, user.ID, pendingPokemon, request)
+		if err != nil || selectedPokemon == nil {
+			return err
+		}
+		selected = true
+		err = tx.Model(selectedPokemon).Updates(map[string]interface{}{
+			"owner_id":         user.ID,
+			"pending_owner_id": nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Unscoped().Delete(&models.OwnedPokemon{}, "pending_owner_id = ?", user.ID).Error
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := recordCatch(tx, selectedPokemon, user.ID, now.UnixMilli()); err != nil {
+			return err
+		}
+		if err := recordSelection(tx, user.ID, *selectedPokemon); err != nil {
+			return err
+		}
+		if err := befriendActiveTeam(tx, user.ID); err != nil {
+			return err
+		}
+		activeEvents, err := events.Active(tx, now)
+		if err != nil {
+			return err
+		}
+		interval := events.NewPokemonInterval(NewPokemonInterval, activeEvents)
+		user.NextPokemonSelectionTimestamp = now.Add(interval).UnixMilli()
+		err = tx.Model(&user).Update("next_pokemon_selection_timestamp", user.NextPokemonSelectionTimestamp).Error
+		if err != nil {
+			return err
+		}
+		return s.ScheduleNewPokemon(tx, user)
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	if selected {
+		s.awardAchievements(achievements.PokemonCaught, user.ID)
+	}
 	c.JSON(http.StatusOK, "ok")
 }
+
+// findSelectedPokemon returns the pending pokemon the request selects, or nil
+// if the request selects by id a pokemon the user already selected
+func findSelectedPokemon(tx *gorm.DB, userID uint, pendingPokemon []models.OwnedPokemon, request SelectPokemonRequest) (*models.OwnedPokemon, error) {
+	if request.PendingPokemonID == nil {
+		if len(pendingPokemon) == 0 {
+			return nil, ErrNoPendingPokemon
+		}
+		if request.PendingPokemonIndex >= uint(len(pendingPokemon)) {
+			return nil, ErrPendingPokemonIndex
+		}
+		return &pendingPokemon[request.PendingPokemonIndex], nil
+	}
+	for i := range pendingPokemon {
+		if pendingPokemon[i].ID == *request.PendingPokemonID {
+			return &pendingPokemon[i], nil
+		}
+	}
+	var numCaught int64
+	err := tx.Model(&models.OwnershipRecord{}).
+		Where("owned_pokemon_id = ? AND owner_id = ? AND method = ?", *request.PendingPokemonID, userID, models.AcquiredByCatching).
+		Count(&numCaught).Error
+	if err != nil {
+		return nil, err
+	}
+	if numCaught > 0 {
+		return nil, nil
+	}
+	return nil, ErrSelectPokemon
+}
@@ -0,0 +1,268 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"susie.mx/gokemon/models"
+	"susie.mx/gokemon/wallet"
+)
+
+const ReleaseCandy = 1
+const ReleaseDust = 100
+const ShinyReleaseDustMultiplier = 10
+const LevelUpCandy = 1
+const LevelUpDust = 100
+const MaxLevel = 100
+const MaxFriendship = 255
+const MaxWalletTransactions = 100
+
+var (
+	ErrReleasePokemon        = ApiError{http.StatusBadRequest, "can only release pokemon you own"}
+	ErrReleaseInTradeRequest = ApiError{http.StatusConflict, "pokemon is part of an open trade request"}
+	ErrReleaseListed         = ApiError{http.StatusConflict, "pokemon is listed on the GTS"}
+	ErrReleaseDeposited      = ApiError{http.StatusConflict, "pokemon is in the wonder trade pool"}
+	ErrReleaseFavorite       = ApiError{http.StatusConflict, "favorite pokemon can not be released"}
+	ErrLevelUpPokemon        = ApiError{http.StatusBadRequest, "can only level up pokemon you own"}
+	ErrMaxLevel              = ApiError{http.StatusBadRequest, "pokemon is already at the max level"}
+	ErrInsufficientBalance   = ApiError{http.StatusBadRequest, "not enough candy or dust"}
+)
+
+// candySpecies returns the species whose candy the pokemon uses, which is the
+// first species of its evolution family
+func candySpecies(tx *gorm.DB, pokemonID uint) (uint, error) {
+	// Evolution families are at most three species long, the limit only
+	// guards against cycles in bad data
+	for i := 0; i < 5; i++ {
+		var evolution models.Evolution
+		result := tx.Where("to_pokemon_id = ?", pokemonID).Limit(1).Find(&evolution)
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		if result.RowsAffected == 0 {
+			break
+		}
+		pokemonID = evolution.FromPokemonID
+	}
+	return pokemonID, nil
+}
+
+// checkReleasable refuses to release a pokemon that someone may still be
+// expecting to trade for
+func checkReleasable(tx *gorm.DB, pokemonID uint) error {
+	var numTradeRequests int64
+	err := tx.Model(&models.TradeRequest{}).
+		Where("status = ? AND (id IN (?) OR id IN (?))",
+			models.TradeRequestOpen,
+			tx.Table("trade_request_user_pokemon").Select("trade_request_id").Where("owned_pokemon_id = ?", pokemonID),
+			tx.Table("trade_request_friend_pokemon").Select("trade_request_id").Where("owned_pokemon_id = ?", pokemonID),
+		).
+		Count(&numTradeRequests).Error
+	if err != nil {
+		return err
+	}
+	if numTradeRequests > 0 {
+		return ErrReleaseInTradeRequest
+	}
+	var numListings int64
+	err = tx.Model(&models.TradeListing{}).
+		Where("status = ? AND owned_pokemon_id = ?", models.TradeListingOpen, pokemonID).
+		Count(&numListings).Error
+	if err != nil {
+		return err
+	}
+	if numListings > 0 {
+		return ErrReleaseListed
+	}
+	var numDeposits int64
+	err = tx.Model(&models.WonderTradeDeposit{}).Where("owned_pokemon_id = ?", pokemonID).Count(&numDeposits).Error
+	if err != nil {
+		return err
+	}
+	if numDeposits > 0 {
+		return ErrReleaseDeposited
+	}
+	return nil
+}
+
+// lockOwnedPokemon locks a pokemon the user owns, returning notOwned if they
+// do not own it
+func lockOwnedPokemon(tx *gorm.DB, id uint64, userID uint, notOwned error) (models.OwnedPokemon, error) {
+	var pokemon models.OwnedPokemon
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&pokemon, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return pokemon, ErrOwnedPokemonNotFound
+	}
+	if err != nil {
+		return pokemon, err
+	}
+	if !isOwnedBy(pokemon, userID) {
+		return pokemon, notOwned
+	}
+	return pokemon, nil
+}
+
+func (s *Server) ReleasePokemon(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
+		})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid owned pokemon id",
+		})
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+
+	var grants []models.WalletTransaction
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		pokemon, err := lockOwnedPokemon(tx, id, user.ID, ErrReleasePokemon)
+		if err != nil {
+			return err
+		}
+		if pokemon.IsFavorite {
+			return ErrReleaseFavorite
+		}
+		if err := checkReleasable(tx, pokemon.ID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&pokemon).Error; err != nil {
+			return err
+		}
+		if err := removeFromTeams(tx, []uint{pokemon.ID}); err != nil {
+			return err
+		}
+		candyPokemonID, err := candySpecies(tx, pokemon.PokemonID)
+		if err != nil {
+			return err
+		}
+		dust := int64(ReleaseDust)
+		if pokemon.IsShiny {
+			dust *= ShinyReleaseDustMultiplier
+		}
+		grants = []models.WalletTransaction{
+			{Resource: models.ResourceCandy, PokemonID: candyPokemonID, Amount: ReleaseCandy},
+			{Resource: models.ResourceDust, Amount: dust},
+		}
+		for i := range grants {
+			grants[i].UserID = user.ID
+			grants[i].Reason = models.WalletReasonRelease
+			grants[i].OwnedPokemonID = &pokemon.ID
+			if err := wallet.Grant(tx, grants[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"granted": grants,
+	})
+}
+
+// LevelUpPokemon spends candy and dust to raise a pokemon's level by one,
+// which also makes it a little friendlier
+func (s *Server) LevelUpPokemon(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
+		})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid owned pokemon id",
+		})
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+
+	var pokemon models.OwnedPokemon
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		pokemon, err = lockOwnedPokemon(tx, id, user.ID, ErrLevelUpPokemon)
+		if err != nil {
+			return err
+		}
+		if pokemon.Level >= MaxLevel {
+			return ErrMaxLevel
+		}
+		candyPokemonID, err := candySpecies(tx, pokemon.PokemonID)
+		if err != nil {
+			return err
+		}
+		costs := []models.WalletTransaction{
+			{Resource: models.ResourceCandy, PokemonID: candyPokemonID, Amount: LevelUpCandy},
+			{Resource: models.ResourceDust, Amount: LevelUpDust},
+		}
+		for _, cost := range costs {
+			cost.UserID = user.ID
+			cost.Reason = models.WalletReasonLevelUp
+			cost.OwnedPokemonID = &pokemon.ID
+			err := wallet.Spend(tx, cost)
+			if errors.Is(err, wallet.ErrInsufficientBalance) {
+				return ErrInsufficientBalance
+			}
+			if err != nil {
+				return err
+			}
+		}
+		pokemon.Level++
+		pokemon.Friendship = gainFriendship(pokemon.Friendship, levelUpFriendship(pokemon.Friendship))
+		return tx.Model(&pokemon).Updates(map[string]interface{}{
+			"level":      pokemon.Level,
+			"friendship": pokemon.Friendship,
+		}).Error
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pokemon)
+}
+
+// walletBalances loads the user's balances, which only they may see
+func walletBalances(db *gorm.DB, userID uint) ([]models.WalletBalance, error) {
+	balances := []models.WalletBalance{}
+	err := db.Order("resource, pokemon_id").Find(&balances, "user_id = ?", userID).Error
+	return balances, err
+}
+
+func (s *Server) GetWalletTransactions(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	transactions := []models.WalletTransaction{}
+	err := s.DB.Order("created_at DESC").
+		Limit(MaxWalletTransactions).
+		Find(&transactions, "user_id = ?", user.ID).Error
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, transactions)
+}
@@ -1,12 +1,27 @@
 package server
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 	"susie.mx/gokemon/discord"
+	"susie.mx/gokemon/encounter"
+	"susie.mx/gokemon/scheduler"
 )
 
 type Server struct {
 	DB            *gorm.DB
 	DiscordClient *discord.Client
 	ClientBaseURL string
+	Scheduler     *scheduler.Scheduler
+	Encounters    *encounter.Store
+
+	EncounterConfigPath string
+
+	TradeRequestExpiry time.Duration
+	// Guarantees a shiny in every ShinyPityBatches-th batch without one, 0
+	// disables the pity
+	ShinyPityBatches uint
+	// Checks nicknames and notes, nil allows everything
+	ProfanityFilter ProfanityFilter
 }
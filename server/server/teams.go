@@ -0,0 +1,336 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"susie.mx/gokemon/battle"
+	"susie.mx/gokemon/models"
+)
+
+const MaxTeams = 20
+const MaxTeamNameLength = 24
+
+// TeamFriendship is how much friendship every pokemon in the active team gains
+// each time its trainer selects a pokemon
+const TeamFriendship = 2
+
+var (
+	ErrTeamNotFound    = ApiError{http.StatusNotFound, "team not found"}
+	ErrTooManyTeams    = ApiError{http.StatusBadRequest, fmt.Sprintf("can not have more than %d teams", MaxTeams)}
+	ErrTeamName        = ApiError{http.StatusBadRequest, "a team needs a name"}
+	ErrTeamNameTooLong = ApiError{http.StatusBadRequest, "team name is too long"}
+	ErrTeamSize        = ApiError{http.StatusBadRequest, fmt.Sprintf("a team must have between 1 and %d pokemon", battle.MaxTeamSize)}
+	ErrTeamPokemon     = ApiError{http.StatusBadRequest, "can only add pokemon you own to a team"}
+)
+
+func preloadTeams(db *gorm.DB) *gorm.DB {
+	return db.Preload("Members.OwnedPokemon.Pokemon.Forms.Sprites").
+		Preload("Members.OwnedPokemon.Pokemon.Forms.Types").
+		Preload("Members.OwnedPokemon.Pokemon.Forms").
+		Preload("Members.OwnedPokemon.Pokemon").
+		Preload("Members.OwnedPokemon").
+		Preload("Members", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position")
+		})
+}
+
+// activeTeam loads the user's active team, or nil if they have none
+func activeTeam(db *gorm.DB, userID uint) (*models.Team, error) {
+	var teams []models.Team
+	err := preloadTeams(db).Limit(1).Find(&teams, "user_id = ? AND is_active", userID).Error
+	if err != nil || len(teams) == 0 {
+		return nil, err
+	}
+	return &teams[0], nil
+}
+
+// befriendActiveTeam lets the pokemon in the user's active team grow friendlier
+// with them
+func befriendActiveTeam(tx *gorm.DB, userID uint) error {
+	members := tx.Model(&models.TeamMember{}).
+		Select("team_members.owned_pokemon_id").
+		Joins("JOIN teams ON teams.id = team_members.team_id").
+		Where("teams.user_id = ? AND teams.is_active", userID)
+	return tx.Model(&models.OwnedPokemon{}).
+		Where("owner_id = ? AND id IN (?)", userID, members).
+		Update("friendship", gorm.Expr("LEAST(friendship + ?, ?)", TeamFriendship, MaxFriendship)).Error
+}
+
+// removeFromTeams takes pokemon that left their owner out of every team they
+// are in
+func removeFromTeams(tx *gorm.DB, ownedPokemonIDs []uint) error {
+	return tx.Where("owned_pokemon_id IN ?", ownedPokemonIDs).Delete(&models.TeamMember{}).Error
+}
+
+// teamMembers checks that the user owns every pokemon and returns them as
+// members in the given order
+func teamMembers(tx *gorm.DB, userID uint, pokemonIDs []uint) ([]models.TeamMember, error) {
+	if len(pokemonIDs) == 0 || len(pokemonIDs) > battle.MaxTeamSize {
+		return nil, ErrTeamSize
+	}
+	var pokemon []models.OwnedPokemon
+	if err := tx.Find(&pokemon, pokemonIDs).Error; err != nil {
+		return nil, err
+	}
+	owned := map[uint]bool{}
+	for _, p := range pokemon {
+		owned[p.ID] = isOwnedBy(p, userID)
+	}
+	members := make([]models.TeamMember, len(pokemonIDs))
+	seen := map[uint]bool{}
+	for i, id := range pokemonIDs {
+		if seen[id] {
+			return nil, ErrDuplicateTeamPokemon
+		}
+		seen[id] = true
+		if !owned[id] {
+			return nil, ErrTeamPokemon
+		}
+		members[i] = models.TeamMember{
+			Position:       uint(i),
+			OwnedPokemonID: id,
+		}
+	}
+	return members, nil
+}
+
+func (s *Server) teamName(name string) (string, error) {
+	name, err := s.normalizeText(name, MaxTeamNameLength, ErrTeamNameTooLong)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		return "", ErrTeamName
+	}
+	return name, nil
+}
+
+// activateTeam makes the team the user's only active team
+func activateTeam(tx *gorm.DB, team *models.Team) error {
+	err := tx.Model(&models.Team{}).
+		Where("user_id = ? AND id <> ? AND is_active", team.UserID, team.ID).
+		Update("is_active", false).Error
+	if err != nil {
+		return err
+	}
+	team.IsActive = true
+	return tx.Model(team).Update("is_active", true).Error
+}
+
+func (s *Server) GetTeams(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	teams := []models.Team{}
+	if err := preloadTeams(s.DB).Order("id").Find(&teams, "user_id = ?", user.ID).Error; err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, teams)
+}
+
+type PostTeamRequest struct {
+	Name       string `json:"name"`
+	PokemonIDs []uint `json:"pokemonIds"`
+	IsActive   bool   `json:"isActive"`
+}
+
+func (s *Server) PostTeam(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
+		})
+		return
+	}
+	var request PostTeamRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid team",
+		})
+		return
+	}
+	name, err := s.teamName(request.Name)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	var team models.Team
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := lockUser(tx, username)
+		if err != nil {
+			return err
+		}
+		var numTeams int64
+		if err := tx.Model(&models.Team{}).Where("user_id = ?", user.ID).Count(&numTeams).Error; err != nil {
+			return err
+		}
+		if numTeams >= MaxTeams {
+			return ErrTooManyTeams
+		}
+		members, err := teamMembers(tx, user.ID, request.PokemonIDs)
+		if err != nil {
+			return err
+		}
+		team = models.Team{
+			UserID:  user.ID,
+			Name:    name,
+			Members: members,
+		}
+		if err := tx.Create(&team).Error; err != nil {
+			return err
+		}
+		// A user's first team is active until they choose another one
+		if request.IsActive || numTeams == 0 {
+			if err := activateTeam(tx, &team); err != nil {
+				return err
+			}
+		}
+		return preloadTeams(tx).First(&team, team.ID).Error
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, team)
+}
+
+// Fields that are left out are not changed. Pokemon replace the team's
+// members in the given order.
+type UpdateTeamRequest struct {
+	TeamID     uint    `json:"teamId"`
+	Name       *string `json:"name"`
+	PokemonIDs []uint  `json:"pokemonIds"`
+	IsActive   *bool   `json:"isActive"`
+}
+
+func (s *Server) UpdateTeam(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
+		})
+		return
+	}
+	var request UpdateTeamRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid team",
+		})
+		return
+	}
+	var team models.Team
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := lockUser(tx, username)
+		if err != nil {
+			return err
+		}
+		team, err = lockTeam(tx, request.TeamID, user.ID)
+		if err != nil {
+			return err
+		}
+		if request.Name != nil {
+			name, err := s.teamName(*request.Name)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&team).Update("name", name).Error; err != nil {
+				return err
+			}
+		}
+		if request.PokemonIDs != nil {
+			members, err := teamMembers(tx, user.ID, request.PokemonIDs)
+			if err != nil {
+				return err
+			}
+			if err := tx.Delete(&models.TeamMember{}, "team_id = ?", team.ID).Error; err != nil {
+				return err
+			}
+			for i := range members {
+				members[i].TeamID = team.ID
+			}
+			if err := tx.Create(&members).Error; err != nil {
+				return err
+			}
+		}
+		if request.IsActive != nil {
+			if *request.IsActive {
+				err = activateTeam(tx, &team)
+			} else {
+				err = tx.Model(&team).Update("is_active", false).Error
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return preloadTeams(tx).First(&team, team.ID).Error
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, team)
+}
+
+func lockTeam(tx *gorm.DB, teamID uint, userID uint) (models.Team, error) {
+	var team models.Team
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&team, teamID).Error
+	// Other users' teams are not found rather than forbidden, since they are
+	// private
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && team.UserID != userID) {
+		return team, ErrTeamNotFound
+	}
+	return team, err
+}
+
+type DeleteTeamRequest struct {
+	TeamID uint `json:"teamId"`
+}
+
+func (s *Server) DeleteTeam(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var request DeleteTeamRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid team",
+		})
+		return
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		user, err := lockUser(tx, username)
+		if err != nil {
+			return err
+		}
+		team, err := lockTeam(tx, request.TeamID, user.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.TeamMember{}, "team_id = ?", team.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&team).Error
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, "ok")
+}
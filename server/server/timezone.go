@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"susie.mx/gokemon/models"
+)
+
+var ErrUnknownTimezone = ApiError{http.StatusBadRequest, "unknown timezone"}
+
+// userTime returns t in the user's timezone, or in UTC if they have not set
+// one
+func userTime(user models.User, t time.Time) time.Time {
+	if user.Timezone == "" {
+		return t.UTC()
+	}
+	location, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		return t.UTC()
+	}
+	return t.In(location)
+}
+
+type UpdateTimezoneRequest struct {
+	// An IANA time zone name such as "America/Mexico_City"
+	Timezone string `json:"timezone"`
+}
+
+func (s *Server) UpdateTimezone(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var request UpdateTimezoneRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid timezone",
+		})
+		return
+	}
+	// time.LoadLocation treats "" as UTC and "Local" as the server's zone
+	if request.Timezone == "Local" {
+		respondWithError(c, ErrUnknownTimezone)
+		return
+	}
+	if _, err := time.LoadLocation(request.Timezone); err != nil {
+		respondWithError(c, ErrUnknownTimezone)
+		return
+	}
+	err := s.DB.Model(&models.User{}).
+		Where("username = ?", username).
+		Update("timezone", request.Timezone).Error
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, "ok")
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"susie.mx/gokemon/models"
+)
+
+const MaxPokemonPerTradeSide = 6
+const DefaultTradeRequestExpiry = 7 * 24 * time.Hour
+const MaxTradeRequestExpiry = 30 * 24 * time.Hour
+
+const ExpireTradeRequestJob = "expireTradeRequest"
+
+var (
+	ErrTradeRequestNotFound  = ApiError{http.StatusNotFound, "trade request not found"}
+	ErrTradeRequestExpiry    = ApiError{http.StatusBadRequest, fmt.Sprintf("trade requests can not last longer than %d hours", MaxTradeRequestExpiry/time.Hour)}
+	ErrNotTradeRecipient     = ApiError{http.StatusForbidden, "only the recipient of a trade request can respond to it"}
+	ErrTradeWithSelf         = ApiError{http.StatusBadRequest, "can not trade with self"}
+	ErrNotFriends            = ApiError{http.StatusBadRequest, "must be friends to trade"}
+	ErrEmptyTradeSide        = ApiError{http.StatusBadRequest, "both sides of a trade must offer at least one pokemon"}
+	ErrTooManyTradePokemon   = ApiError{http.StatusBadRequest, fmt.Sprintf("can not trade more than %d pokemon at once", MaxPokemonPerTradeSide)}
+	ErrDuplicateTradePokemon = ApiError{http.StatusBadRequest, "a pokemon can only be offered once per trade"}
+	ErrTradePokemonMissing   = ApiError{http.StatusConflict, "a pokemon in this trade no longer exists"}
+	ErrTradePokemonNotOwned  = ApiError{http.StatusConflict, "a pokemon in this trade is not owned by its trader"}
+)
+
+func areFriends(tx *gorm.DB, userID uint, friendID uint) (bool, error) {
+	var numFriendships int64
+	err := tx.Table("user_friends").
+		Where("user_id = ? AND friend_id = ?", userID, friendID).
+		Count(&numFriendships).Error
+	return numFriendships > 0, err
+}
+
+// validateTradeOffer checks that userID and friendID can trade the given
+// pokemon with each other and returns each side's pokemon. The pokemon are
+// locked in id order so that trades sharing a pokemon can not deadlock.
+func validateTradeOffer(tx *gorm.DB, userID uint, userPokemonIDs []uint, friendID uint, friendPokemonIDs []uint) ([]models.OwnedPokemon, []models.OwnedPokemon, error) {
+	if userID == friendID {
+		return nil, nil, ErrTradeWithSelf
+	}
+	if len(userPokemonIDs) == 0 || len(friendPokemonIDs) == 0 {
+		return nil, nil, ErrEmptyTradeSide
+	}
+	if len(userPokemonIDs) > MaxPokemonPerTradeSide || len(friendPokemonIDs) > MaxPokemonPerTradeSide {
+		return nil, nil, ErrTooManyTradePokemon
+	}
+	owners := map[uint]uint{}
+	for _, id := range userPokemonIDs {
+		owners[id] = userID
+	}
+	for _, id := range friendPokemonIDs {
+		owners[id] = friendID
+	}
+	if len(owners) != len(userPokemonIDs)+len(friendPokemonIDs) {
+		return nil, nil, ErrDuplicateTradePokemon
+	}
+	friends, err := areFriends(tx, userID, friendID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !friends {
+		return nil, nil, ErrNotFriends
+	}
+
+	var pokemon []models.OwnedPokemon
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Order("id").
+		Find(&pokemon, append(append([]uint{}, userPokemonIDs...), friendPokemonIDs...)).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(pokemon) != len(owners) {
+		return nil, nil, ErrTradePokemonMissing
+	}
+	var userPokemon, friendPokemon []models.OwnedPokemon
+	for _, p := range pokemon {
+		if !isOwnedBy(p, owners[p.ID]) {
+			return nil, nil, ErrTradePokemonNotOwned
+		}
+		if owners[p.ID] == userID {
+			userPokemon = append(userPokemon, p)
+		} else {
+			friendPokemon = append(friendPokemon, p)
+		}
+	}
+	return userPokemon, friendPokemon, nil
+}
+
+// executeTrade swaps the pokemon of a trade request on behalf of its recipient
+// and records the trade in the ledger. Pokemon that evolve by being traded do
+// so once they have changed hands.
+// It must be run inside a transaction: the trade request and its pokemon are
+// locked so that concurrent accepts can not apply the same trade twice or trade
+// away a pokemon that has already changed hands.
+func executeTrade(tx *gorm.DB, tradeRequestID uint, acceptingUserID uint) (models.Trade, []models.EvolutionRecord, error) {
+	var tradeRequest models.TradeRequest
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&tradeRequest, tradeRequestID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Trade{}, nil, ErrTradeRequestNotFound
+	}
+	if err != nil {
+		return models.Trade{}, nil, err
+	}
+	if err := checkTradeRequestOpen(tradeRequest); err != nil {
+		return models.Trade{}, nil, err
+	}
+	if tradeRequest.FriendID != acceptingUserID {
+		return models.Trade{}, nil, ErrNotTradeRecipient
+	}
+	userPokemonIDs, friendPokemonIDs, err := tradeRequestPokemonIDs(tx, tradeRequest)
+	if err != nil {
+		return models.Trade{}, nil, err
+	}
+	userPokemon, friendPokemon, err := validateTradeOffer(tx, tradeRequest.UserID, userPokemonIDs, tradeRequest.FriendID, friendPokemonIDs)
+	if err != nil {
+		return models.Trade{}, nil, err
+	}
+
+	now := time.Now().UnixMilli()
+	err = tx.Model(&tradeRequest).Updates(map[string]interface{}{
+		"status":    models.TradeRequestAccepted,
+		"closed_at": now,
+	}).Error
+	if err != nil {
+		return models.Trade{}, nil, err
+	}
+	trade := models.Trade{
+		TradeRequestID: &tradeRequest.ID,
+		UserID:         tradeRequest.UserID,
+		UserPokemon:    userPokemon,
+		FriendID:       tradeRequest.FriendID,
+		FriendPokemon:  friendPokemon,
+		RequestedAt:    tradeRequest.CreatedAt,
+		CompletedAt:    now,
+	}
+	if err := tx.Omit("UserPokemon.*", "FriendPokemon.*").Create(&trade).Error; err != nil {
+		return models.Trade{}, nil, err
+	}
+	for i := range userPokemon {
+		err := transferPokemon(tx, &userPokemon[i], tradeRequest.FriendID, trade.ID, trade.CompletedAt)
+		if err != nil {
+			return models.Trade{}, nil, err
+		}
+	}
+	for i := range friendPokemon {
+		err := transferPokemon(tx, &friendPokemon[i], tradeRequest.UserID, trade.ID, trade.CompletedAt)
+		if err != nil {
+			return models.Trade{}, nil, err
+		}
+	}
+	// Both sides are traded for what the other side offered before evolving
+	offeredUserPokemon := append([]models.OwnedPokemon{}, userPokemon...)
+	evolutions, err := applyTradeEvolutions(tx, userPokemon, friendPokemon, now)
+	if err != nil {
+		return models.Trade{}, nil, err
+	}
+	friendEvolutions, err := applyTradeEvolutions(tx, friendPokemon, offeredUserPokemon, now)
+	if err != nil {
+		return models.Trade{}, nil, err
+	}
+	return trade, append(evolutions, friendEvolutions...), nil
+}
+
+func tradeRequestPokemonIDs(tx *gorm.DB, tradeRequest models.TradeRequest) ([]uint, []uint, error) {
+	var userPokemonIDs, friendPokemonIDs []uint
+	err := tx.Table("trade_request_user_pokemon").
+		Where("trade_request_id = ?", tradeRequest.ID).
+		Pluck("owned_pokemon_id", &userPokemonIDs).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	err = tx.Table("trade_request_friend_pokemon").
+		Where("trade_request_id = ?", tradeRequest.ID).
+		Pluck("owned_pokemon_id", &friendPokemonIDs).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	return userPokemonIDs, friendPokemonIDs, nil
+}
+
+func checkTradeRequestOpen(tradeRequest models.TradeRequest) error {
+	if tradeRequest.Status == models.TradeRequestOpen && tradeRequest.ExpiresAt <= time.Now().UnixMilli() {
+		return ApiError{http.StatusConflict, fmt.Sprintf("trade request is %s", models.TradeRequestExpired)}
+	}
+	if tradeRequest.Status != models.TradeRequestOpen {
+		return ApiError{http.StatusConflict, fmt.Sprintf("trade request is %s", tradeRequest.Status)}
+	}
+	return nil
+}
+
+func (s *Server) tradeRequestExpiresAt(expiresInHours uint, now time.Time) (int64, error) {
+	expiry := s.TradeRequestExpiry
+	if expiresInHours != 0 {
+		expiry = time.Duration(expiresInHours) * time.Hour
+	}
+	if expiry <= 0 {
+		expiry = DefaultTradeRequestExpiry
+	}
+	if expiry > MaxTradeRequestExpiry {
+		return 0, ErrTradeRequestExpiry
+	}
+	return now.Add(expiry).UnixMilli(), nil
+}
+
+func (s *Server) ExpireTradeRequest(tx *gorm.DB, job models.Job) error {
+	return tx.Model(&models.TradeRequest{}).
+		Where("id = ? AND status = ?", job.SubjectID, models.TradeRequestOpen).
+		Updates(map[string]interface{}{
+			"status":    models.TradeRequestExpired,
+			"closed_at": time.Now().UnixMilli(),
+		}).Error
+}
+
+// invalidateTradeRequests closes every open trade request that involves any of
+// the given pokemon, since at least one side can no longer hold up its end.
+func invalidateTradeRequests(tx *gorm.DB, ownedPokemonIDs []uint) error {
+	return tx.Model(&models.TradeRequest{}).
+		Where("status = ? AND (id IN (?) OR id IN (?))",
+			models.TradeRequestOpen,
+			tx.Table("trade_request_user_pokemon").Select("trade_request_id").Where("owned_pokemon_id IN ?", ownedPokemonIDs),
+			tx.Table("trade_request_friend_pokemon").Select("trade_request_id").Where("owned_pokemon_id IN ?", ownedPokemonIDs),
+		).
+		Updates(map[string]interface{}{
+			"status":    models.TradeRequestInvalidated,
+			"closed_at": time.Now().UnixMilli(),
+		}).Error
+}
+
+func isOwnedBy(pokemon models.OwnedPokemon, userID uint) bool {
+	return pokemon.OwnerID != nil && *pokemon.OwnerID == userID
+}
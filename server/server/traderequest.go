@@ -1,60 +1,98 @@
 package server
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"susie.mx/gokemon/models"
 )
 
-func (s *Server) GetTradeRequests(c *gin.Context) {
-	session := sessions.Default(c)
-	username := session.Get("username")
-	if username == nil {
-		c.JSON(http.StatusUnauthorized, nil)
-		return
-	}
-	var user models.User
-	s.DB.First(&user, "username = ?", username)
-	sentTradeRequests := []models.TradeRequest{}
-	s.DB.Preload("User").
-		Preload("UserPokemon.Pokemon.Forms.Sprites").
-		Preload("UserPokemon.Pokemon.Forms.Types").
-		Preload("UserPokemon.Pokemon.Forms").
-		Preload("UserPokemon.Pokemon").
-		Preload("UserPokemon").
-		Preload("Friend").
-		Preload("FriendPokemon.Pokemon.Forms.Sprites").
-		Preload("FriendPokemon.Pokemon.Forms.Types").
-		Preload("FriendPokemon.Pokemon.Forms").
-		Preload("FriendPokemon.Pokemon").
-		Preload("FriendPokemon").
-		Find(&sentTradeRequests, "user_id = ?", user.ID)
-	receivedTradeRequests := []models.TradeRequest{}
-	s.DB.Preload("User").
+type TradeThread struct {
+	ID        uint                  `json:"id"`
+	Latest    models.TradeRequest   `json:"latest"`
+	Proposals []models.TradeRequest `json:"proposals"`
+}
+
+func preloadTradeRequests(db *gorm.DB) *gorm.DB {
+	return db.Preload("User").
 		Preload("UserPokemon.Pokemon.Forms.Sprites").
 		Preload("UserPokemon.Pokemon.Forms.Types").
 		Preload("UserPokemon.Pokemon.Forms").
 		Preload("UserPokemon.Pokemon").
-		Preload("UserPokemon").
+		Preload("UserPokemon", unscoped).
 		Preload("Friend").
 		Preload("FriendPokemon.Pokemon.Forms.Sprites").
 		Preload("FriendPokemon.Pokemon.Forms.Types").
 		Preload("FriendPokemon.Pokemon.Forms").
 		Preload("FriendPokemon.Pokemon").
-		Preload("FriendPokemon").
-		Find(&receivedTradeRequests, "friend_id = ?", user.ID)
-	c.JSON(http.StatusOK, gin.H{
-		"sent":     sentTradeRequests,
-		"received": receivedTradeRequests,
-	})
+		Preload("FriendPokemon", unscoped)
+}
+
+func (s *Server) GetTradeRequests(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	var tradeRequests []models.TradeRequest
+	err := preloadTradeRequests(s.DB).
+		Order("id").
+		Find(&tradeRequests, "user_id = ? OR friend_id = ?", user.ID, user.ID).Error
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	threads := map[uint]*TradeThread{}
+	var threadIDs []uint
+	for _, tradeRequest := range tradeRequests {
+		thread, ok := threads[tradeRequest.ThreadID]
+		if !ok {
+			thread = &TradeThread{ID: tradeRequest.ThreadID}
+			threads[tradeRequest.ThreadID] = thread
+			threadIDs = append(threadIDs, tradeRequest.ThreadID)
+		}
+		thread.Proposals = append(thread.Proposals, tradeRequest)
+		if tradeRequest.SupersededByID == nil {
+			thread.Latest = tradeRequest
+		}
+	}
+	// An open thread is sent or received depending on who has to respond to it next
+	sentTradeThreads := []TradeThread{}
+	receivedTradeThreads := []TradeThread{}
+	closedTradeThreads := []TradeThread{}
+	for _, id := range threadIDs {
+		thread := threads[id]
+		if thread.Latest.Status != models.TradeRequestOpen {
+			closedTradeThreads = append(closedTradeThreads, *thread)
+		} else if thread.Latest.UserID == user.ID {
+			sentTradeThreads = append(sentTradeThreads, *thread)
+		} else {
+			receivedTradeThreads = append(receivedTradeThreads, *thread)
+		}
+	}
+	obj := gin.H{
+		"sent":     sentTradeThreads,
+		"received": receivedTradeThreads,
+	}
+	if c.Query("includeClosed") == "true" {
+		obj["closed"] = closedTradeThreads
+	}
+	c.JSON(http.StatusOK, obj)
 }
 
 type PostTradeRequestRequest struct {
-	PokemonID       uint `json:"pokemonId"`
-	FriendID        uint `json:"friendId"`
-	FriendPokemonID uint `json:"friendPokemonId"`
+	PokemonIDs       []uint `json:"pokemonIds"`
+	FriendID         uint   `json:"friendId"`
+	FriendPokemonIDs []uint `json:"friendPokemonIds"`
+	ExpiresInHours   uint   `json:"expiresInHours"`
 }
 
 func (s *Server) PostTradeRequest(c *gin.Context) {
@@ -68,59 +106,172 @@ func (s *Server) PostTradeRequest(c *gin.Context) {
 		return
 	}
 	var user models.User
-	s.DB.Preload("Friends").First(&user, "username = ?", username)
-	// Can not trade with self
+	s.DB.First(&user, "username = ?", username)
 	var tradeRequestRequest PostTradeRequestRequest
-	c.BindJSON(&tradeRequestRequest)
-	if user.ID == tradeRequestRequest.FriendID {
+	if err := c.ShouldBindJSON(&tradeRequestRequest); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "can not trade with self",
+			"error": "invalid trade request",
 		})
 		return
 	}
-	// Must be friends to trade
-	areFriends := false
-	for _, friend := range user.Friends {
-		if friend.ID == tradeRequestRequest.FriendID {
-			areFriends = true
+	now := time.Now()
+	expiresAt, err := s.tradeRequestExpiresAt(tradeRequestRequest.ExpiresInHours, now)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		userPokemon, friendPokemon, err := validateTradeOffer(tx,
+			user.ID, tradeRequestRequest.PokemonIDs,
+			tradeRequestRequest.FriendID, tradeRequestRequest.FriendPokemonIDs,
+		)
+		if err != nil {
+			return err
+		}
+		// Can not have multiple trades of the same pokemon with the same friend
+		duplicate, err := hasOpenTradeRequest(tx, user.ID, tradeRequestRequest.FriendID, userPokemon, friendPokemon)
+		if err != nil {
+			return err
+		}
+		if duplicate {
+			return ApiError{http.StatusBadRequest, "can not have multiple trades of the same pokemon with the same friend"}
+		}
+		tradeRequest := models.TradeRequest{
+			Status:        models.TradeRequestOpen,
+			UserID:        user.ID,
+			UserPokemon:   userPokemon,
+			FriendID:      tradeRequestRequest.FriendID,
+			FriendPokemon: friendPokemon,
+			ExpiresAt:     expiresAt,
+		}
+		if err := tx.Omit("UserPokemon.*", "FriendPokemon.*").Create(&tradeRequest).Error; err != nil {
+			return err
+		}
+		// A new trade request starts its own negotiation thread
+		if err := tx.Model(&tradeRequest).Update("thread_id", tradeRequest.ID).Error; err != nil {
+			return err
 		}
+		return s.Scheduler.Schedule(tx, ExpireTradeRequestJob, tradeRequest.ID, time.UnixMilli(expiresAt))
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
 	}
-	if !areFriends {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "must be friends to trade",
+	c.JSON(http.StatusOK, "ok")
+}
+
+func hasOpenTradeRequest(tx *gorm.DB, userID uint, friendID uint, userPokemon []models.OwnedPokemon, friendPokemon []models.OwnedPokemon) (bool, error) {
+	var openTradeRequests []models.TradeRequest
+	err := tx.Preload("UserPokemon").
+		Preload("FriendPokemon").
+		Find(&openTradeRequests, "user_id = ? AND friend_id = ? AND status = ?", userID, friendID, models.TradeRequestOpen).Error
+	if err != nil {
+		return false, err
+	}
+	for _, tradeRequest := range openTradeRequests {
+		if samePokemon(tradeRequest.UserPokemon, userPokemon) && samePokemon(tradeRequest.FriendPokemon, friendPokemon) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func samePokemon(a []models.OwnedPokemon, b []models.OwnedPokemon) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	ids := map[uint]bool{}
+	for _, p := range a {
+		ids[p.ID] = true
+	}
+	for _, p := range b {
+		if !ids[p.ID] {
+			return false
+		}
+	}
+	return true
+}
+
+type CounterTradeRequestRequest struct {
+	TradeRequestID   uint   `json:"tradeRequestId"`
+	PokemonIDs       []uint `json:"pokemonIds"`
+	FriendPokemonIDs []uint `json:"friendPokemonIds"`
+	ExpiresInHours   uint   `json:"expiresInHours"`
+}
+
+func (s *Server) CounterTradeRequest(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
 		})
 		return
 	}
-	// Can not have multiple trades of same pokemon with same friend
-	var TradeRequest models.TradeRequest
-	s.DB.First(&TradeRequest, "user_id = ? AND user_pokemon_id = ? AND friend_id = ? AND friend_pokemon_id = ?",
-		user.ID,
-		tradeRequestRequest.PokemonID,
-		tradeRequestRequest.FriendID,
-		tradeRequestRequest.FriendPokemonID,
-	)
-	if TradeRequest.ID != 0 {
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	var counterRequest CounterTradeRequestRequest
+	if err := c.ShouldBindJSON(&counterRequest); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "can not have multiple trades of the same pokemon with the same friend",
+			"error": "invalid counter offer",
 		})
 		return
 	}
-
-	var pokemon models.OwnedPokemon
-	s.DB.First(&pokemon, tradeRequestRequest.PokemonID)
-
-	var friend models.User
-	s.DB.First(&friend, tradeRequestRequest.FriendID)
-
-	var friendPokemon models.OwnedPokemon
-	s.DB.First(&friendPokemon, tradeRequestRequest.FriendPokemonID)
-
-	s.DB.Create(&models.TradeRequest{
-		User:          user,
-		UserPokemon:   pokemon,
-		Friend:        friend,
-		FriendPokemon: friendPokemon,
+	now := time.Now()
+	expiresAt, err := s.tradeRequestExpiresAt(counterRequest.ExpiresInHours, now)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		var previous models.TradeRequest
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&previous, counterRequest.TradeRequestID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTradeRequestNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkTradeRequestOpen(previous); err != nil {
+			return err
+		}
+		// Only the user who has to respond to an offer can counter it
+		if previous.FriendID != user.ID {
+			return ErrNotTradeRecipient
+		}
+		userPokemon, friendPokemon, err := validateTradeOffer(tx,
+			user.ID, counterRequest.PokemonIDs,
+			previous.UserID, counterRequest.FriendPokemonIDs,
+		)
+		if err != nil {
+			return err
+		}
+		counterOffer := models.TradeRequest{
+			ThreadID:      previous.ThreadID,
+			Status:        models.TradeRequestOpen,
+			UserID:        user.ID,
+			UserPokemon:   userPokemon,
+			FriendID:      previous.UserID,
+			FriendPokemon: friendPokemon,
+			ExpiresAt:     expiresAt,
+		}
+		if err := tx.Omit("UserPokemon.*", "FriendPokemon.*").Create(&counterOffer).Error; err != nil {
+			return err
+		}
+		err = tx.Model(&previous).Updates(map[string]interface{}{
+			"superseded_by_id": counterOffer.ID,
+			"status":           models.TradeRequestCountered,
+			"closed_at":        now.UnixMilli(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return s.Scheduler.Schedule(tx, ExpireTradeRequestJob, counterOffer.ID, time.UnixMilli(expiresAt))
 	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, "ok")
 }
 
@@ -141,14 +292,30 @@ func (s *Server) DeleteTradeRequest(c *gin.Context) {
 	var loggedInUser models.User
 	s.DB.First(&loggedInUser, "username = ?", username)
 
-	var tradeRequest models.TradeRequest
-	s.DB.First(&tradeRequest, "id = ?", tradeRequestRequest.TradeRequestID)
-
-	if loggedInUser.ID != tradeRequest.UserID && loggedInUser.ID != tradeRequest.FriendID {
-		c.JSON(http.StatusUnauthorized, nil)
+	// Either side declining the latest offer ends the negotiation
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var tradeRequest models.TradeRequest
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&tradeRequest, tradeRequestRequest.TradeRequestID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTradeRequestNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if loggedInUser.ID != tradeRequest.UserID && loggedInUser.ID != tradeRequest.FriendID {
+			return ApiError{http.StatusUnauthorized, "not part of this trade request"}
+		}
+		if err := checkTradeRequestOpen(tradeRequest); err != nil {
+			return err
+		}
+		return tx.Model(&tradeRequest).Updates(map[string]interface{}{
+			"status":    models.TradeRequestDeclined,
+			"closed_at": time.Now().UnixMilli(),
+		}).Error
+	})
+	if err != nil {
+		respondWithError(c, err)
 		return
 	}
-
-	s.DB.Delete(&models.TradeRequest{}, tradeRequestRequest.TradeRequestID)
 	c.JSON(http.StatusOK, "ok")
 }
@@ -6,11 +6,18 @@ import (
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"susie.mx/gokemon/achievements"
 	"susie.mx/gokemon/dbtypes"
 	"susie.mx/gokemon/models"
 )
 
+// orderByID keeps pending pokemon in the order SelectPokemon indexes them in
+func orderByID(db *gorm.DB) *gorm.DB {
+	return db.Order("id")
+}
+
 func (s *Server) GetUser(c *gin.Context) {
 	session := sessions.Default(c)
 	loggedInUsername := session.Get("username")
@@ -32,10 +39,26 @@ func (s *Server) GetUser(c *gin.Context) {
 			Preload("PendingPokemon.Pokemon.Forms.Types").
 			Preload("PendingPokemon.Pokemon.Forms").
 			Preload("PendingPokemon.Pokemon").
+			Preload("PendingPokemon", orderByID).
+			Preload("HeldPokemon.Pokemon.Forms.Sprites").
+			Preload("HeldPokemon.Pokemon.Forms.Types").
+			Preload("HeldPokemon.Pokemon.Forms").
+			Preload("HeldPokemon.Pokemon").
 			Preload(clause.Associations).
 			First(&loggedInUser, "username = ?", loggedInUsername)
 	}
 	if loggedInUser.ID != 0 {
+		team, err := activeTeam(s.DB, loggedInUser.ID)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+		loggedInUser.ActiveTeam = team
+		loggedInUser.Wallet, err = walletBalances(s.DB, loggedInUser.ID)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
 		obj["loggedInUser"] = loggedInUser
 	}
 
@@ -50,10 +73,21 @@ func (s *Server) GetUser(c *gin.Context) {
 			Preload("PendingPokemon.Pokemon.Forms.Types").
 			Preload("PendingPokemon.Pokemon.Forms").
 			Preload("PendingPokemon.Pokemon").
+			Preload("PendingPokemon", orderByID).
+			Preload("HeldPokemon.Pokemon.Forms.Sprites").
+			Preload("HeldPokemon.Pokemon.Forms.Types").
+			Preload("HeldPokemon.Pokemon.Forms").
+			Preload("HeldPokemon.Pokemon").
 			Preload(clause.Associations).
 			First(&user, "username = ?", username)
 	}
 	if user.ID != 0 {
+		team, err := activeTeam(s.DB, user.ID)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+		user.ActiveTeam = team
 		obj["user"] = user
 	}
 
@@ -76,6 +110,7 @@ func (s *Server) PostFriendship(c *gin.Context) {
 	s.DB.Model(&user).Association("Friends").Append(&friend)
 	s.DB.Model(&friend).Association("Friends").Append(&user)
 	s.DB.Delete(&models.FriendRequest{}, friendRequest.ID)
+	s.awardAchievements(achievements.FriendAdded, user.ID, friend.ID)
 	c.JSON(http.StatusOK, "ok")
 }
 
@@ -105,28 +140,43 @@ type AcceptTradeRequest struct {
 }
 
 func (s *Server) AcceptTrade(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
+		})
+		return
+	}
 	var acceptTradeRequest AcceptTradeRequest
-	c.BindJSON(&acceptTradeRequest)
-
-	var tradeRequest models.TradeRequest
-	s.DB.Preload("User").
-		Preload("UserPokemon").
-		Preload("Friend").
-		Preload("FriendPokemon").First(&tradeRequest, acceptTradeRequest.TradeRequestID)
-	user := tradeRequest.User                   // susie
-	userPokemon := tradeRequest.UserPokemon     // metapod
-	friend := tradeRequest.Friend               // yvanna
-	friendPokemon := tradeRequest.FriendPokemon // ivysaur
-
-	s.DB.Model(&user).Association("OwnedPokemon").Delete(&userPokemon)
-	s.DB.Model(&friend).Association("OwnedPokemon").Delete(&friendPokemon)
-	s.DB.Model(&user).Association("OwnedPokemon").Append(&friendPokemon)
-	s.DB.Model(&friend).Association("OwnedPokemon").Append(&userPokemon)
-	s.DB.Delete(&models.TradeRequest{}, "user_id = ? AND user_pokemon_id = ?", user.ID, userPokemon.ID)
-	s.DB.Delete(&models.TradeRequest{}, "friend_id = ? AND friend_pokemon_id = ?", user.ID, userPokemon.ID)
-	s.DB.Delete(&models.TradeRequest{}, "user_id = ? AND user_pokemon_id = ?", friend.ID, friendPokemon.ID)
-	s.DB.Delete(&models.TradeRequest{}, "friend_id = ? AND friend_pokemon_id = ?", friend.ID, friendPokemon.ID)
-	c.JSON(http.StatusOK, "ok")
+	if err := c.ShouldBindJSON(&acceptTradeRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid accept trade request",
+		})
+		return
+	}
+	var loggedInUser models.User
+	s.DB.First(&loggedInUser, "username = ?", username)
+
+	var trade models.Trade
+	var evolutions []models.EvolutionRecord
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		trade, evolutions, err = executeTrade(tx, acceptTradeRequest.TradeRequestID, loggedInUser.ID)
+		return err
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	s.awardAchievements(achievements.TradeCompleted, trade.UserID, trade.FriendID)
+	if len(evolutions) > 0 {
+		s.awardAchievements(achievements.PokemonEvolved, trade.UserID, trade.FriendID)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"trade":      trade,
+		"evolutions": evolutions,
+	})
 }
 
 type UpdatePreferredFormRequest struct {
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"susie.mx/gokemon/models"
+	"susie.mx/gokemon/wishlist"
+)
+
+const MaxWishlistEntries = 100
+
+func (s *Server) GetWishlist(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	entries := []models.WishlistEntry{}
+	err := s.DB.
+		Preload("Pokemon.Forms.Sprites").
+		Preload("Pokemon.Forms.Types").
+		Preload("Pokemon.Forms").
+		Preload("Pokemon").
+		Find(&entries, "user_id = ?", user.ID).Error
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+type PostWishlistEntryRequest struct {
+	PokemonID uint  `json:"pokemonId"`
+	FormIndex *uint `json:"formIndex"`
+	IsShiny   *bool `json:"isShiny"`
+}
+
+func (s *Server) PostWishlistEntry(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	var request PostWishlistEntryRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid wishlist entry",
+		})
+		return
+	}
+	var pokemon models.Pokemon
+	err := s.DB.Preload("Forms").First(&pokemon, request.PokemonID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) ||
+		(err == nil && request.FormIndex != nil && int(*request.FormIndex) >= len(pokemon.Forms)) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "wished for pokemon does not exist",
+		})
+		return
+	}
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	var numEntries int64
+	s.DB.Model(&models.WishlistEntry{}).Where("user_id = ?", user.ID).Count(&numEntries)
+	if numEntries >= MaxWishlistEntries {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "wishlist is full",
+		})
+		return
+	}
+	entry := models.WishlistEntry{
+		UserID:    user.ID,
+		PokemonID: pokemon.ID,
+		FormIndex: request.FormIndex,
+		IsShiny:   request.IsShiny,
+	}
+	if err := s.DB.Create(&entry).Error; err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+type DeleteWishlistEntryRequest struct {
+	WishlistEntryID uint `json:"wishlistEntryId"`
+}
+
+func (s *Server) DeleteWishlistEntry(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	var request DeleteWishlistEntryRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid wishlist entry",
+		})
+		return
+	}
+	err := s.DB.Delete(&models.WishlistEntry{}, "id = ? AND user_id = ?", request.WishlistEntryID, user.ID).Error
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, "ok")
+}
+
+func (s *Server) GetTradeSuggestions(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	suggestions, err := wishlist.Suggestions(s.DB, user.ID)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, suggestions)
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"susie.mx/gokemon/achievements"
+	"susie.mx/gokemon/models"
+)
+
+// Matching takes a transaction scoped advisory lock with this key so that two
+// simultaneous depositors always see each other's deposits
+const wonderTradeLockKey = 7_000_001
+
+var (
+	ErrWonderTradePokemon  = ApiError{http.StatusBadRequest, "can only wonder trade pokemon you own"}
+	ErrAlreadyDeposited    = ApiError{http.StatusBadRequest, "pokemon is already in the wonder trade pool"}
+	ErrWonderTradeNotFound = ApiError{http.StatusNotFound, "wonder trade deposit not found"}
+	ErrWonderTradeFavorite = ApiError{http.StatusBadRequest, "favorite pokemon can not be wonder traded"}
+)
+
+func (s *Server) GetWonderTradeDeposits(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	deposits := []models.WonderTradeDeposit{}
+	err := s.DB.
+		Preload("OwnedPokemon.Pokemon.Forms.Sprites").
+		Preload("OwnedPokemon.Pokemon.Forms.Types").
+		Preload("OwnedPokemon.Pokemon.Forms").
+		Preload("OwnedPokemon.Pokemon").
+		Preload("OwnedPokemon").
+		Find(&deposits, "user_id = ?", user.ID).Error
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, deposits)
+}
+
+type PostWonderTradeRequest struct {
+	OwnedPokemonID uint `json:"ownedPokemonId"`
+}
+
+func (s *Server) PostWonderTrade(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "must be logged in",
+		})
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	var request PostWonderTradeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid wonder trade",
+		})
+		return
+	}
+	var trade *models.Trade
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		trade, err = depositWonderTrade(tx, user.ID, request.OwnedPokemonID)
+		return err
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	if trade != nil {
+		s.awardAchievements(achievements.TradeCompleted, trade.UserID, trade.FriendID)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"matched": trade != nil,
+		"trade":   trade,
+	})
+}
+
+// depositWonderTrade puts a pokemon into the wonder trade pool, immediately
+// swapping it with a random earlier deposit if there is one. A user is never
+// matched with themselves, nor handed a pokemon they have owned before.
+func depositWonderTrade(tx *gorm.DB, userID uint, ownedPokemonID uint) (*models.Trade, error) {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", wonderTradeLockKey).Error; err != nil {
+		return nil, err
+	}
+	var pokemon models.OwnedPokemon
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Pokemon").First(&pokemon, ownedPokemonID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !isOwnedBy(pokemon, userID)) {
+		return nil, ErrWonderTradePokemon
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pokemon.IsFavorite {
+		return nil, ErrWonderTradeFavorite
+	}
+	var numDeposits int64
+	err = tx.Model(&models.WonderTradeDeposit{}).Where("owned_pokemon_id = ?", pokemon.ID).Count(&numDeposits).Error
+	if err != nil {
+		return nil, err
+	}
+	if numDeposits > 0 {
+		return nil, ErrAlreadyDeposited
+	}
+
+	match, matchedPokemon, err := findWonderTradeMatch(tx, userID, pokemon.ID)
+	if err != nil {
+		return nil, err
+	}
+	if match == nil {
+		return nil, tx.Create(&models.WonderTradeDeposit{
+			UserID:         userID,
+			OwnedPokemonID: pokemon.ID,
+		}).Error
+	}
+	now := time.Now().UnixMilli()
+	trade := models.Trade{
+		IsWonderTrade: true,
+		UserID:        match.UserID,
+		UserPokemon:   []models.OwnedPokemon{matchedPokemon},
+		FriendID:      userID,
+		FriendPokemon: []models.OwnedPokemon{pokemon},
+		RequestedAt:   match.CreatedAt,
+		CompletedAt:   now,
+	}
+	if err := tx.Omit("UserPokemon.*", "FriendPokemon.*").Create(&trade).Error; err != nil {
+		return nil, err
+	}
+	// Transferring the matched pokemon also withdraws its deposit
+	if err := transferPokemon(tx, &matchedPokemon, userID, trade.ID, now); err != nil {
+		return nil, err
+	}
+	if err := transferPokemon(tx, &pokemon, match.UserID, trade.ID, now); err != nil {
+		return nil, err
+	}
+	err = notify(tx, match.UserID, fmt.Sprintf("Your wonder trade of %s was matched! You received %s.", matchedPokemon.Pokemon.Name, pokemon.Pokemon.Name))
+	if err != nil {
+		return nil, err
+	}
+	err = notify(tx, userID, fmt.Sprintf("Your wonder trade of %s was matched! You received %s.", pokemon.Pokemon.Name, matchedPokemon.Pokemon.Name))
+	if err != nil {
+		return nil, err
+	}
+	return &trade, nil
+}
+
+// findWonderTradeMatch picks a random deposit the user can be matched with and
+// locks its pokemon. Deposits whose pokemon is gone or no longer owned by the
+// depositor are deleted on the way. It returns a nil deposit if there is no
+// match.
+func findWonderTradeMatch(tx *gorm.DB, userID uint, pokemonID uint) (*models.WonderTradeDeposit, models.OwnedPokemon, error) {
+	for {
+		var match models.WonderTradeDeposit
+		result := tx.Preload("OwnedPokemon.Pokemon").
+			Where("user_id <> ?", userID).
+			Where("NOT EXISTS (SELECT 1 FROM ownership_records WHERE owned_pokemon_id = wonder_trade_deposits.owned_pokemon_id AND owner_id = ?)", userID).
+			Where("NOT EXISTS (SELECT 1 FROM ownership_records WHERE owned_pokemon_id = ? AND owner_id = wonder_trade_deposits.user_id)", pokemonID).
+			Order("random()").
+			Limit(1).
+			Find(&match)
+		if result.Error != nil {
+			return nil, models.OwnedPokemon{}, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, models.OwnedPokemon{}, nil
+		}
+		matchedPokemon := match.OwnedPokemon
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&matchedPokemon, match.OwnedPokemonID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.OwnedPokemon{}, err
+		}
+		if err == nil && isOwnedBy(matchedPokemon, match.UserID) {
+			return &match, matchedPokemon, nil
+		}
+		if err := tx.Delete(&match).Error; err != nil {
+			return nil, models.OwnedPokemon{}, err
+		}
+	}
+}
+
+type DeleteWonderTradeRequest struct {
+	WonderTradeDepositID uint `json:"wonderTradeDepositId"`
+}
+
+func (s *Server) DeleteWonderTrade(c *gin.Context) {
+	session := sessions.Default(c)
+	username := session.Get("username")
+	if username == nil {
+		c.JSON(http.StatusUnauthorized, nil)
+		return
+	}
+	var user models.User
+	s.DB.First(&user, "username = ?", username)
+	var request DeleteWonderTradeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid wonder trade deposit",
+		})
+		return
+	}
+	result := s.DB.Delete(&models.WonderTradeDeposit{}, "id = ? AND user_id = ?", request.WonderTradeDepositID, user.ID)
+	if result.Error != nil {
+		respondWithError(c, result.Error)
+		return
+	}
+	if result.RowsAffected == 0 {
+		respondWithError(c, ErrWonderTradeNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, "ok")
+}
+
+func withdrawWonderTradeDeposits(tx *gorm.DB, ownedPokemonIDs []uint) error {
+	return tx.Delete(&models.WonderTradeDeposit{}, "owned_pokemon_id IN ?", ownedPokemonIDs).Error
+}
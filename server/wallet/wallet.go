@@ -0,0 +1,60 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"susie.mx/gokemon/models"
+)
+
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+// Grant adds the transaction's amount to the user's balance and records it
+func Grant(tx *gorm.DB, transaction models.WalletTransaction) error {
+	if transaction.Amount <= 0 {
+		return fmt.Errorf("granting non-positive amount(%d) of %s", transaction.Amount, transaction.Resource)
+	}
+	err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "resource"}, {Name: "pokemon_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"amount": gorm.Expr("wallet_balances.amount + excluded.amount"),
+		}),
+	}).Create(&models.WalletBalance{
+		UserID:    transaction.UserID,
+		Resource:  transaction.Resource,
+		PokemonID: transaction.PokemonID,
+		Amount:    transaction.Amount,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Create(&transaction).Error
+}
+
+// Spend takes the transaction's amount from the user's balance and records it
+// as a negative amount. It returns ErrInsufficientBalance if the balance is
+// too low.
+func Spend(tx *gorm.DB, transaction models.WalletTransaction) error {
+	if transaction.Amount <= 0 {
+		return fmt.Errorf("spending non-positive amount(%d) of %s", transaction.Amount, transaction.Resource)
+	}
+	var balance models.WalletBalance
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND resource = ? AND pokemon_id = ?", transaction.UserID, transaction.Resource, transaction.PokemonID).
+		Limit(1).
+		Find(&balance)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 || balance.Amount < transaction.Amount {
+		return ErrInsufficientBalance
+	}
+	err := tx.Model(&balance).Update("amount", gorm.Expr("amount - ?", transaction.Amount)).Error
+	if err != nil {
+		return err
+	}
+	transaction.Amount = -transaction.Amount
+	return tx.Create(&transaction).Error
+}
@@ -0,0 +1,118 @@
+package wishlist
+
+import (
+	"sort"
+
+	"gorm.io/gorm"
+	"susie.mx/gokemon/models"
+)
+
+type Suggestion struct {
+	Friend models.User `json:"friend"`
+	// Pokemon the friend owns that are on the user's wishlist
+	Receive []models.OwnedPokemon `json:"receive"`
+	// Pokemon the user owns that are on the friend's wishlist
+	Give []models.OwnedPokemon `json:"give"`
+	// A one for one trade request both sides would want, if there is one
+	PokemonIDs       []uint `json:"pokemonIds"`
+	FriendPokemonIDs []uint `json:"friendPokemonIds"`
+	// Species the friend owns more than one of, which they can spare
+	Spares map[uint]bool `json:"spares"`
+}
+
+func (s Suggestion) IsMutual() bool {
+	return len(s.Receive) > 0 && len(s.Give) > 0
+}
+
+func Matches(entry models.WishlistEntry, pokemon models.OwnedPokemon) bool {
+	if entry.PokemonID != pokemon.PokemonID {
+		return false
+	}
+	if entry.FormIndex != nil && *entry.FormIndex != pokemon.FormIndex {
+		return false
+	}
+	if entry.IsShiny != nil && *entry.IsShiny != pokemon.IsShiny {
+		return false
+	}
+	return true
+}
+
+// Suggestions cross references the user's wishlist with their friends'
+// pokemon and vice versa. Mutually beneficial suggestions come first, and
+// within each suggestion pokemon that their owner has duplicates of come first.
+func Suggestions(db *gorm.DB, userID uint) ([]Suggestion, error) {
+	var user models.User
+	err := db.Preload("Friends").
+		Preload("OwnedPokemon.Pokemon").
+		First(&user, userID).Error
+	if err != nil {
+		return nil, err
+	}
+	var wishlist []models.WishlistEntry
+	if err := db.Find(&wishlist, "user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+
+	suggestions := []Suggestion{}
+	for _, friend := range user.Friends {
+		var friendPokemon []models.OwnedPokemon
+		if err := db.Preload("Pokemon").Find(&friendPokemon, "owner_id = ?", friend.ID).Error; err != nil {
+			return nil, err
+		}
+		var friendWishlist []models.WishlistEntry
+		if err := db.Find(&friendWishlist, "user_id = ?", friend.ID).Error; err != nil {
+			return nil, err
+		}
+		suggestion := Suggestion{
+			Friend:  *friend,
+			Receive: wanted(wishlist, friendPokemon),
+			Give:    wanted(friendWishlist, user.OwnedPokemon),
+		}
+		if len(suggestion.Receive) == 0 && len(suggestion.Give) == 0 {
+			continue
+		}
+		suggestion.Friend.Friends = nil
+		if suggestion.IsMutual() {
+			suggestion.PokemonIDs = []uint{suggestion.Give[0].ID}
+			suggestion.FriendPokemonIDs = []uint{suggestion.Receive[0].ID}
+		}
+		suggestion.Spares = spares(friendPokemon)
+		suggestions = append(suggestions, suggestion)
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].IsMutual() && !suggestions[j].IsMutual()
+	})
+	return suggestions, nil
+}
+
+// wanted returns the pokemon that match any wishlist entry, duplicates first
+func wanted(wishlist []models.WishlistEntry, pokemon []models.OwnedPokemon) []models.OwnedPokemon {
+	duplicates := spares(pokemon)
+	matches := []models.OwnedPokemon{}
+	for _, p := range pokemon {
+		for _, entry := range wishlist {
+			if Matches(entry, p) {
+				matches = append(matches, p)
+				break
+			}
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return duplicates[matches[i].PokemonID] && !duplicates[matches[j].PokemonID]
+	})
+	return matches
+}
+
+func spares(pokemon []models.OwnedPokemon) map[uint]bool {
+	counts := map[uint]int{}
+	for _, p := range pokemon {
+		counts[p.PokemonID]++
+	}
+	spares := map[uint]bool{}
+	for id, count := range counts {
+		if count > 1 {
+			spares[id] = true
+		}
+	}
+	return spares
+}